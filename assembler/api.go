@@ -0,0 +1,165 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+// Options changes how source code is assembled and linked.
+type Options struct {
+	// Info describes the ROM. If it's nil, Assemble reads it from the info.toml in the file system.
+	Info *rom.Info
+
+	// IncludePaths are folders in the file system that included files are looked for in, if they aren't next to the file including them.
+	// The ones from the info, which are also relative to the root of the file system, are used after these.
+	IncludePaths []string
+}
+
+// Result is a finished ROM, along with information about what's in it.
+type Result struct {
+	ROM           []byte
+	Labels        map[string]rom.Label
+	Constants     map[string]int
+	UsedByteCount int
+
+	// UsedRAMByteCounts is how much of each type of RAM section is reserved, like WRAM0 or HRAM.
+	UsedRAMByteCounts map[string]int
+
+	// Objects are what was linked into the ROM, which can be used to make a listing.
+	Objects []*object.Object
+
+	// Dependencies are the paths of every file in the file system that Assemble used, including binary files, images, and info.toml if it was read.
+	// Link leaves them empty, since it doesn't read any files.
+	Dependencies []string
+
+	// Diagnostics has any warnings, and the errors if assembling failed.
+	Diagnostics []diagnostics.Diagnostic
+}
+
+// Error is returned when there are errors in the source code. The details are in Diagnostics.
+type Error struct {
+	Diagnostics []diagnostics.Diagnostic
+}
+
+func (e *Error) Error() string {
+	errorCount := 0
+	first := ""
+	for _, diagnostic := range e.Diagnostics {
+		if diagnostic.Severity == diagnostics.Error {
+			if errorCount == 0 {
+				first = diagnostic.String()
+			}
+			errorCount++
+		}
+	}
+	if errorCount > 1 {
+		return fmt.Sprintf("%s (and %d more errors)", first, errorCount-1)
+	}
+	return first
+}
+
+// the assembler keeps its state in globals, so only one thing can use it at a time
+var lock sync.Mutex
+
+// Assemble assembles the entry file, and anything it includes, from the given file system into a ROM.
+// If there are errors in the source code, the error is an *Error, and the Result still has the diagnostics.
+func Assemble(fsys fs.FS, entry string, options Options) (*Result, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	info := rom.Info{}
+	if options.Info != nil {
+		info = *options.Info
+	} else {
+		var err error
+		info, err = ReadConfigFile(fsys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := setUpROM(info); err != nil {
+		return nil, err
+	}
+
+	diagnostics.Reset()
+	includePaths := append(append([]string{}, options.IncludePaths...), info.IncludePaths...)
+	mainObject := Assembler_ParseFile(fsys, entry, includePaths, true)
+	if diagnostics.HasErrors() {
+		return &Result{Diagnostics: diagnostics.Current}, &Error{diagnostics.Current}
+	}
+
+	result, err := link([]*object.Object{mainObject})
+	if result != nil {
+		result.Dependencies = mainObject.Dependencies
+		if options.Info == nil {
+			result.Dependencies = append(result.Dependencies, "info.toml")
+		}
+	}
+	return result, err
+}
+
+// AssembleObject assembles the entry file, and anything it includes, from the given file system into an object.
+// The object can be linked with others using Link. Only the include paths from the options are used.
+func AssembleObject(fsys fs.FS, entry string, options Options) (*object.Object, []diagnostics.Diagnostic, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	diagnostics.Reset()
+	result := Assembler_ParseFile(fsys, entry, options.IncludePaths, false)
+	if diagnostics.HasErrors() {
+		return nil, diagnostics.Current, &Error{diagnostics.Current}
+	}
+	return result, diagnostics.Current, nil
+}
+
+// Link links the given objects together into a ROM. The options must include the ROM info.
+func Link(objects []*object.Object, options Options) (*Result, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if options.Info == nil {
+		return nil, errors.New("missing ROM info")
+	}
+	if err := setUpROM(*options.Info); err != nil {
+		return nil, err
+	}
+
+	diagnostics.Reset()
+	return link(objects)
+}
+
+// setUpROM starts a new ROM with the given info.
+func setUpROM(info rom.Info) error {
+	rom.Current = rom.ROM{Info: info}
+	if err := rom.ValidateParameters(); err != nil {
+		return err
+	}
+	rom.Initialize()
+	return nil
+}
+
+// link links the objects into the ROM that was set up, and returns the result.
+func link(objects []*object.Object) (*Result, error) {
+	Linker_Link(objects)
+	if diagnostics.HasErrors() {
+		return &Result{Diagnostics: diagnostics.Current}, &Error{diagnostics.Current}
+	}
+
+	rom.Finalize()
+
+	return &Result{
+		ROM:               rom.Current.Output,
+		Labels:            rom.Current.Labels,
+		Constants:         Linker_Constants,
+		UsedByteCount:     rom.Current.UsedByteCount,
+		UsedRAMByteCounts: rom.Current.UsedRAMByteCounts,
+		Objects:           objects,
+		Diagnostics:       diagnostics.Current,
+	}, nil
+}
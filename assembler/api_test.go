@@ -0,0 +1,230 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func TestAssemble(t *testing.T) {
+	fsys := fstest.MapFS{
+		"info.toml":   &fstest.MapFile{Data: []byte("Name = \"TEST\"\n")},
+		"main.s":      &fstest.MapFile{Data: []byte(".def VALUE 5\nstart:\n\tld a, VALUE\n\tjp start\n.incasm \"lib/other.s\"\n")},
+		"lib/other.s": &fstest.MapFile{Data: []byte("other:\n\tret\n")},
+	}
+
+	result, err := Assemble(fsys, "main.s", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0x3E, 0x05, 0xC3, 0x50, 0x01, 0xC9}
+	for i, b := range expected {
+		if result.ROM[0x150+i] != b {
+			t.Errorf("Byte at 0x%X was 0x%02X, should have been 0x%02X", 0x150+i, result.ROM[0x150+i], b)
+		}
+	}
+	if string(result.ROM[0x134:0x138]) != "TEST" {
+		t.Errorf("Name in header was '%s'", result.ROM[0x134:0x138])
+	}
+	if result.Labels["other"] != (rom.Label{Bank: 0, Address: 0x155}) {
+		t.Errorf("Label 'other' was at %+v", result.Labels["other"])
+	}
+	if result.Constants["VALUE"] != 5 {
+		t.Errorf("Constant 'VALUE' was %d", result.Constants["VALUE"])
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s": &fstest.MapFile{Data: []byte("\tld a, 300\n\tbogus\n\tnop\n")},
+	}
+
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	sourceError, isSourceError := err.(*Error)
+	if !isSourceError {
+		t.Fatalf("Error was %v, should have been an *Error", err)
+	}
+	if len(sourceError.Diagnostics) != 2 || len(result.Diagnostics) != 2 {
+		t.Fatalf("Got %d diagnostics, should have been 2", len(sourceError.Diagnostics))
+	}
+	if err.Error() != "main.s:1:2: error: Byte value 300 out of range (and 1 more errors)" {
+		t.Errorf("Error message was '%s'", err.Error())
+	}
+
+	if _, err := Assemble(fsys, "main.s", Options{}); err == nil || err.Error() != "missing info.toml file" {
+		t.Errorf("Error without info.toml was %v", err)
+	}
+
+	// warnings don't stop it from working
+	fsys["main.s"] = &fstest.MapFile{Data: []byte("\tdw 0x12345, -1\n\tdw label + 0x10000\nlabel:\n")}
+	result, err = Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"main.s:1:2: warning: Word value 74565 out of range, it was truncated to 0x2345",
+		"main.s:2: warning: Word value 65878 out of range, it was truncated to 0x0156",
+	}
+	if len(result.Diagnostics) != len(expected) {
+		t.Fatalf("Got diagnostics %v, should have been %v", result.Diagnostics, expected)
+	}
+	for i, diagnostic := range result.Diagnostics {
+		if diagnostic.String() != expected[i] {
+			t.Errorf("Diagnostic %d was '%s', should have been '%s'", i, diagnostic.String(), expected[i])
+		}
+	}
+	if output := result.ROM[0x150:0x156]; string(output) != "\x45\x23\xFF\xFF\x56\x01" {
+		t.Errorf("Output was % X", output)
+	}
+}
+
+func TestLinkConstants(t *testing.T) {
+	fsys := fstest.MapFS{
+		"hardware.s": &fstest.MapFile{Data: []byte(".def LCDC 0xFF40\n")},
+		"main.s":     &fstest.MapFile{Data: []byte(".incasm \"hardware.s\"\n.def SPEED 2\n.section \"main\", ROM0\nstart:\n\tld a, [LCDC]\n")},
+		"sound.s":    &fstest.MapFile{Data: []byte(".incasm \"hardware.s\"\n.def VOLUME 7\n.section \"sound\", ROMX\nplaySound:\n\tld a, VOLUME\n")},
+	}
+	objects := []*object.Object{}
+	for _, entry := range []string{"main.s", "sound.s"} {
+		o, _, err := AssembleObject(fsys, entry, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, o)
+	}
+
+	result, err := Link(objects, Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Constants) != 3 || result.Constants["LCDC"] != 0xFF40 || result.Constants["SPEED"] != 2 || result.Constants["VOLUME"] != 7 {
+		t.Errorf("Constants were %+v", result.Constants)
+	}
+
+	objects[1].Constants["SPEED"] = 3
+	if _, err := Link(objects, Options{Info: &rom.Info{Name: "TEST"}}); err == nil || err.Error() != "error: Constant 'SPEED' is 2 in one object and 3 in another" {
+		t.Errorf("Error was '%v'", err)
+	}
+}
+
+func TestAssembleRAM(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s": &fstest.MapFile{Data: []byte("start: ld a, [second]\n\tds 2\n.section \"vars\", WRAM0\nfirst: ds 3\nsecond:\n\t.res 1\n.section \"hram\", HRAM\nhFrame: ds 1\n")},
+	}
+
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0xFA, 0x03, 0xC0, 0x00, 0x00}
+	for i, b := range expected {
+		if result.ROM[0x150+i] != b {
+			t.Errorf("Byte at 0x%X was 0x%02X, should have been 0x%02X", 0x150+i, result.ROM[0x150+i], b)
+		}
+	}
+	if result.Labels["hFrame"] != (rom.Label{Bank: 0, Address: 0xFF80}) {
+		t.Errorf("Label 'hFrame' was at %+v", result.Labels["hFrame"])
+	}
+	if result.UsedByteCount != 5 || result.UsedRAMByteCounts["WRAM0"] != 4 || result.UsedRAMByteCounts["HRAM"] != 1 {
+		t.Errorf("Usage was %d bytes of ROM and %v of RAM", result.UsedByteCount, result.UsedRAMByteCounts)
+	}
+
+	fsys["main.s"] = &fstest.MapFile{Data: []byte(".section \"vars\", WRAM0\n\tnop\n.section \"hram\", HRAM\n\tds 0x80\n")}
+	_, err = Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if sourceError, isSourceError := err.(*Error); !isSourceError || len(sourceError.Diagnostics) != 2 {
+		t.Errorf("Error was %v, should have been 2 errors", err)
+	}
+}
+
+func TestEntryAndVectors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s": &fstest.MapFile{Data: []byte("\tnop\nstart:\n\tjr start\nonVBlank:\n\treti\n.vector timer\n\tpush af\n\tpop af\n\treti\n")},
+	}
+	info := rom.Info{Name: "TEST", Entry: "start", Vectors: map[string]string{"vblank": "onVBlank"}}
+
+	result, err := Assemble(fsys, "main.s", Options{Info: &info})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int][]byte{
+		0x100: []byte{0x00, 0xC3, 0x51, 0x01}, // nop, jp start
+		0x40:  []byte{0xC3, 0x53, 0x01},       // jp onVBlank
+		0x50:  []byte{0xF5, 0xF1, 0xD9},       // push af, pop af, reti
+	}
+	for address, bytes := range expected {
+		for i, b := range bytes {
+			if result.ROM[address+i] != b {
+				t.Errorf("Byte at 0x%X was 0x%02X, should have been 0x%02X", address+i, result.ROM[address+i], b)
+			}
+		}
+	}
+
+	errorTests := []struct {
+		source string
+		info   rom.Info
+	}{
+		{"start:\n\tnop\n", rom.Info{Name: "TEST", Entry: "missing"}},
+		{".section \"far\", ROMX\nstart:\n\tnop\n", rom.Info{Name: "TEST", Entry: "start"}},
+		{".vector vblank\n\tnop\nhandler:\n\tnop\n", rom.Info{Name: "TEST", Vectors: map[string]string{"vblank": "handler"}}},
+		{".vector joypad\n\tds 9\n", rom.Info{Name: "TEST"}},
+		{".vector reset\n", rom.Info{Name: "TEST"}},
+		{"start:\n\tnop\n", rom.Info{Name: "TEST", Vectors: map[string]string{"nmi": "start"}}},
+	}
+	for _, test := range errorTests {
+		fsys["main.s"] = &fstest.MapFile{Data: []byte(test.source)}
+		if _, err := Assemble(fsys, "main.s", Options{Info: &test.info}); err == nil {
+			t.Errorf("Assembling '%s' with %+v should have failed", test.source, test.info)
+		}
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"info.toml": &fstest.MapFile{Data: []byte("Name = \"TEST\"\nCGB = \"NONE\"\nOldLicensee = 0\n\n[Vectors]\nvblank = \"onVBlank\"\n")},
+	}
+	info, err := ReadConfigFile(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "TEST" || info.CGB != "NONE" || info.OldLicensee == nil || *info.OldLicensee != 0 || info.Vectors["vblank"] != "onVBlank" {
+		t.Errorf("Info was %+v", info)
+	}
+
+	fsys["info.toml"] = &fstest.MapFile{Data: []byte("Name = \"TEST\"\nBatery = true\nColour = true\n")}
+	if _, err := ReadConfigFile(fsys); err == nil || err.Error() != "unknown settings 'Batery', 'Colour' in info.toml" {
+		t.Errorf("Reading info with unknown settings gave error '%v'", err)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	fsys := fstest.MapFS{
+		"info.toml":      &fstest.MapFile{Data: []byte("Name = \"TEST\"\nIncludePaths = [\"lib\"]\n")},
+		"main.s":         &fstest.MapFile{Data: []byte(".incasm \"hardware.s\"\n.incasm \"data/tables.s\"\n.incasm \"hardware.s\"\n")},
+		"lib/hardware.s": &fstest.MapFile{Data: []byte(".once\n.def LCDC 0xFF40\n")},
+		"data/tables.s":  &fstest.MapFile{Data: []byte(".incbin \"sine.bin\"\n")},
+		"data/sine.bin":  &fstest.MapFile{Data: []byte{0, 1, 2}},
+		"unused.s":       &fstest.MapFile{Data: []byte("\tnop\n")},
+	}
+
+	result, err := Assemble(fsys, "main.s", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"main.s", "lib/hardware.s", "data/tables.s", "data/sine.bin", "info.toml"}
+	if strings.Join(result.Dependencies, " ") != strings.Join(expected, " ") {
+		t.Errorf("Dependencies were %v, should have been %v", result.Dependencies, expected)
+	}
+
+	// info.toml isn't used if the info is given
+	result, err = Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST", IncludePaths: []string{"lib"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Dependencies) != 4 {
+		t.Errorf("Dependencies were %v", result.Dependencies)
+	}
+}
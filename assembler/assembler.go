@@ -0,0 +1,953 @@
+package assembler
+
+import (
+	"bufio"
+	"bytes"
+	"image/png"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/gfx"
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/parser"
+	"github.com/thatoddmailbox/gbasm/rom"
+	"github.com/thatoddmailbox/gbasm/utils"
+)
+
+type Instruction struct {
+	Mnemonic string
+	Operands []string
+}
+
+// Assembler_Object is the object that is currently being assembled.
+var Assembler_Object *object.Object
+
+// Assembler_Section is the section that output currently goes into.
+var Assembler_Section *object.Section
+
+// Assembler_ScopeLabel is the most recent global label, which local labels belong to.
+var Assembler_ScopeLabel string
+
+// Assembler_FS is the file system that source files are read from.
+var Assembler_FS fs.FS
+
+// Assembler_IncludePaths are folders in Assembler_FS that included files are looked for in, if they aren't next to the file including them.
+var Assembler_IncludePaths []string
+
+// Assembler_IncludeStack is the chain of files being assembled, starting with the main one, so that include cycles can be found.
+var Assembler_IncludeStack []string
+
+// Assembler_OnceFiles are the files with a .once directive that have already been included in the current pass.
+var Assembler_OnceFiles map[string]bool
+
+// Assembler_Dependencies are the paths of all the files that have been read, in order.
+var Assembler_Dependencies []string
+
+// SourceLine is a line of source code, along with where it came from.
+type SourceLine struct {
+	Text       string
+	FileBase   string
+	LineNumber int
+	Column     int // where the text starts in the line, for diagnostics
+}
+
+// Assembler_ParseFile assembles the given file, and anything it includes, into an object.
+// Any problems are reported to the diagnostics package, and the object is only complete if there aren't any errors.
+// Included files are looked for next to the file including them, and then in the include paths.
+// If hasDefaultSection is true, anything before the first section directive goes into a fixed section at 0x150.
+func Assembler_ParseFile(fsys fs.FS, filePath string, includePaths []string, hasDefaultSection bool) *object.Object {
+	filePath = path.Clean(filePath)
+	fileBase := path.Base(filePath)
+
+	Assembler_FS = fsys
+	Assembler_IncludePaths = includePaths
+	Assembler_Dependencies = []string{}
+	rom.Current.Definitions = map[string]int{}
+	rom.Current.UnpointedDefinitions = []string{}
+	rom.Current.DeclaredConstants = []string{}
+	rom.Current.Labels = map[string]rom.Label{}
+	rom.Current.SectionSizes = map[string]int{}
+	rom.Current.Relocatable = true
+
+	// the first pass finds the labels and constants, the second one creates the actual output
+	Macros_Reset()
+	Assembler_ScopeLabel = ""
+	Assembler_IncludeStack = []string{}
+	Assembler_OnceFiles = map[string]bool{}
+	diagnostics.Try(fileBase, 0, 0, func() {
+		Assembler_FindLabelsInFile(filePath, fileBase)
+	})
+
+	Macros_Reset()
+	Assembler_ScopeLabel = ""
+	Assembler_IncludeStack = []string{}
+	Assembler_OnceFiles = map[string]bool{}
+	rom.Current.UnpointedDefinitions = []string{}
+	rom.Current.DeclaredConstants = []string{}
+	Assembler_Object = object.New()
+	Assembler_Section = nil
+	if hasDefaultSection {
+		Assembler_Section = Assembler_StartSection(fileBase, "ROM0", 0, 0x150, fileBase, 0)
+	}
+	diagnostics.Try(fileBase, 0, 0, func() {
+		Assembler_ParseFilePass(filePath, fileBase, 0, 1)
+	})
+
+	for name, value := range rom.Current.Definitions {
+		Assembler_Object.Constants[name] = value
+	}
+	Assembler_Object.Dependencies = Assembler_Dependencies
+
+	return Assembler_Object
+}
+
+// Assembler_ReadFile reads the lines of the given file, without any comments or empty lines.
+func Assembler_ReadFile(filePath string, fileBase string) []SourceLine {
+	fileContents, err := fs.ReadFile(Assembler_FS, filePath)
+	if err != nil {
+		diagnostics.Fatalf(fileBase, 0, "Couldn't open file: %s", err)
+	}
+	Assembler_AddDependency(filePath)
+
+	lines := []SourceLine{}
+	scanner := bufio.NewScanner(bytes.NewReader(fileContents))
+	lineNumber := 0
+	inMultilineComment := false
+	for scanner.Scan() {
+		lineNumber++
+		text := ""
+		text, inMultilineComment = Assembler_StripComments(scanner.Text(), inMultilineComment)
+		column := len(text) - len(strings.TrimLeft(text, " \t")) + 1
+		text = strings.TrimSpace(text)
+		if len(text) == 0 {
+			continue
+		}
+		if labelEnd := strings.IndexAny(text, " \t"); labelEnd > 1 && text[labelEnd-1] == ':' {
+			// there's a label and something else on the same line, like "playerX: ds 1", so they get split up
+			lines = append(lines, SourceLine{text[:labelEnd], fileBase, lineNumber, column})
+			rest := strings.TrimLeft(text[labelEnd:], " \t")
+			column += len(text) - len(rest)
+			text = rest
+		}
+		lines = append(lines, SourceLine{text, fileBase, lineNumber, column})
+	}
+
+	if err = scanner.Err(); err != nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "Couldn't read file: %s", err)
+	}
+
+	return lines
+}
+
+// Assembler_StripComments removes any comments from the given line.
+// It returns whether the line ends inside of a multi-line comment, which should be passed in with the next line.
+func Assembler_StripComments(line string, inMultilineComment bool) (string, bool) {
+	result := ""
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		char := line[i]
+		hasNext := i+1 < len(line)
+		if inMultilineComment {
+			if char == '*' && hasNext && line[i+1] == '/' {
+				inMultilineComment = false
+				i++
+			}
+			continue
+		}
+
+		if quote != 0 {
+			if char == quote {
+				quote = 0
+			}
+		} else if char == '"' || char == '\'' {
+			quote = char
+		} else if char == ';' || (char == '/' && hasNext && line[i+1] == '/') {
+			// single-line comment
+			break
+		} else if char == '/' && hasNext && line[i+1] == '*' {
+			// start of multi-line comment
+			inMultilineComment = true
+			i++
+			continue
+		}
+		result += string(char)
+	}
+	return result, inMultilineComment
+}
+
+func Assembler_FindLabelsInFile(filePath string, fileBase string) {
+	Assembler_IncludeStack = append(Assembler_IncludeStack, filePath)
+	Macros_ExpandLines(Assembler_ReadFile(filePath, fileBase), 0, 0, func(sourceLine SourceLine) {
+		line, fileBase, lineNumber := sourceLine.Text, sourceLine.FileBase, sourceLine.LineNumber
+		if line[0] == '.' {
+			instructionParts := strings.Fields(line)
+			switch instructionParts[0] {
+			case ".incasm":
+				// get the labels from the included file
+				includedFilePath, ok := Assembler_FindIncludedSource(line[len(".incasm"):], path.Dir(filePath), fileBase, lineNumber)
+				if ok {
+					Assembler_FindLabelsInFile(includedFilePath, path.Base(includedFilePath))
+				}
+
+			case ".once":
+				Assembler_OnceFiles[filePath] = true
+
+			case ".def":
+				// constants are found here, so that everything after them can use them
+				if len(instructionParts) < 3 {
+					diagnostics.Fatalf(fileBase, lineNumber, "Expected name and value")
+				}
+				key := instructionParts[1]
+
+				val := Assembler_GetConstant(strings.Join(instructionParts[2:], " "), 0, fileBase, lineNumber)
+
+				_, exists := rom.Current.Definitions[key]
+				if exists || utils.StringInSlice(key, rom.Current.UnpointedDefinitions) {
+					diagnostics.Fatalf(fileBase, lineNumber, "Tried to declare already existing label or constant '%s'", key)
+				}
+
+				rom.Current.Definitions[key] = val
+				rom.Current.DeclaredConstants = append(rom.Current.DeclaredConstants, key)
+			}
+		}
+		if line[len(line)-1] == ':' {
+			// it's a label
+			labelName := Assembler_DeclareLabel(line[:len(line)-1], fileBase, lineNumber)
+
+			_, existsInDefs := rom.Current.Definitions[labelName]
+			existsInUnpointedDefs := utils.StringInSlice(labelName, rom.Current.UnpointedDefinitions)
+			if existsInDefs || existsInUnpointedDefs {
+				diagnostics.Fatalf(fileBase, lineNumber, "Tried to declare already existing label or constant '%s'", labelName)
+			}
+
+			rom.Current.UnpointedDefinitions = append(rom.Current.UnpointedDefinitions, labelName)
+		}
+	})
+	Assembler_IncludeStack = Assembler_IncludeStack[:len(Assembler_IncludeStack)-1]
+}
+
+func Assembler_ParseFilePass(filePath string, fileBase string, outputIndex int, pass int) int {
+	handleLine := func(sourceLine SourceLine) {
+		line, fileBase, lineNumber := sourceLine.Text, sourceLine.FileBase, sourceLine.LineNumber
+
+		if line[0] == '.' && len(line) > 1 && line[len(line)-1] != ':' {
+			// special instruction
+			instructionParts := strings.Fields(line)
+			switch instructionParts[0][1:] {
+			case "def":
+				// constants were already found along with the labels, but .ifdef should only see the ones before it
+				if len(instructionParts) > 1 {
+					rom.Current.DeclaredConstants = append(rom.Current.DeclaredConstants, instructionParts[1])
+				}
+
+			case "org":
+				// start a new fixed section at that address
+				if len(instructionParts) != 2 {
+					diagnostics.Fatalf(fileBase, lineNumber, "Expected address")
+				}
+				newOrigin := Assembler_GetConstant(instructionParts[1], pass, fileBase, lineNumber)
+				if newOrigin < 0 || newOrigin >= 2*rom.BankSize {
+					diagnostics.Fatalf(fileBase, lineNumber, "Origin 0x%X is not a ROM address", newOrigin)
+				}
+
+				sectionType := "ROM0"
+				bank := 0
+				if newOrigin >= rom.BankSize {
+					// stay in the current bank, if there is one
+					sectionType = "ROMX"
+					bank = 1
+					if Assembler_Section != nil && Assembler_Section.Type == "ROMX" {
+						bank = Assembler_Section.Bank
+					}
+				}
+
+				Assembler_Section = Assembler_StartSection(fileBase+":"+strconv.Itoa(lineNumber), sectionType, bank, newOrigin, fileBase, lineNumber)
+				outputIndex = Assembler_Section.Size
+
+			case "bank":
+				// start a new fixed section at the beginning of that bank
+				if len(instructionParts) != 2 {
+					diagnostics.Fatalf(fileBase, lineNumber, "Expected bank number")
+				}
+				newBank := Assembler_GetConstant(instructionParts[1], pass, fileBase, lineNumber)
+				if newBank < 1 {
+					diagnostics.Fatalf(fileBase, lineNumber, "Bank %d is not a switchable bank", newBank)
+				}
+
+				Assembler_Section = Assembler_StartSection(fileBase+":"+strconv.Itoa(lineNumber), "ROMX", newBank, rom.BankSize, fileBase, lineNumber)
+				outputIndex = Assembler_Section.Size
+
+			case "section":
+				Assembler_Section = Assembler_ParseSectionDirective(line, pass, fileBase, lineNumber)
+				outputIndex = Assembler_Section.Size
+
+			case "vector":
+				// start a section in the space for that vector
+				if len(instructionParts) != 2 {
+					diagnostics.Fatalf(fileBase, lineNumber, "Expected name of vector")
+				}
+				name := strings.ToLower(instructionParts[1])
+				address, ok := rom.Vectors[name]
+				if !ok {
+					diagnostics.Fatalf(fileBase, lineNumber, "Unknown vector '%s'", instructionParts[1])
+				}
+				Assembler_Section = Assembler_StartSection(name+" vector", "ROM0", 0, address, fileBase, lineNumber)
+				Assembler_Section.MaxSize = rom.VectorSize
+				outputIndex = Assembler_Section.Size
+
+			case "incasm":
+				includedFilePath, ok := Assembler_FindIncludedSource(line[len(".incasm"):], path.Dir(filePath), fileBase, lineNumber)
+				if ok {
+					outputIndex = Assembler_ParseFilePass(includedFilePath, path.Base(includedFilePath), outputIndex, pass)
+				}
+
+			case "once":
+				Assembler_OnceFiles[filePath] = true
+
+			case "incbin":
+				outputIndex = Assembler_IncludeBinary(line[len(".incbin"):], path.Dir(filePath), outputIndex, pass, fileBase, lineNumber)
+
+			case "res", "fill":
+				outputIndex = Assembler_Reserve(Macros_SplitArguments(strings.TrimSpace(line[len(instructionParts[0]):])), outputIndex, pass, fileBase, lineNumber)
+
+			case "align":
+				outputIndex = Assembler_Align(Macros_SplitArguments(strings.TrimSpace(line[len(".align"):])), outputIndex, pass, fileBase, lineNumber)
+
+			case "padto":
+				outputIndex = Assembler_PadTo(Macros_SplitArguments(strings.TrimSpace(line[len(".padto"):])), outputIndex, pass, fileBase, lineNumber)
+
+			case "assert":
+				Assembler_Assert(Macros_SplitArguments(strings.TrimSpace(line[len(".assert"):])), pass, fileBase, lineNumber)
+
+			case "incgfx":
+				outputIndex = Assembler_IncludeGraphics(line[len(".incgfx"):], path.Dir(filePath), outputIndex, pass, fileBase, lineNumber)
+
+			default:
+				diagnostics.Fatalf(fileBase, lineNumber, "Unknown special instruction '%s'", instructionParts[0][1:])
+			}
+		} else {
+			// it's either a label or instruction
+
+			// is it a label?
+			if line[len(line)-1] == ':' {
+				// it is
+				labelName := Assembler_DeclareLabel(line[:len(line)-1], fileBase, lineNumber)
+
+				_, exists := rom.Current.Definitions[labelName]
+				if exists {
+					diagnostics.Fatalf(fileBase, lineNumber, "Tried to declare already existing label or constant '%s'", labelName)
+				}
+				if Assembler_Section == nil {
+					diagnostics.Fatalf(fileBase, lineNumber, "Label '%s' is not in a section", labelName)
+				}
+
+				// keep track of the labels so far, for .ifdef
+				rom.Current.UnpointedDefinitions = append(rom.Current.UnpointedDefinitions, labelName)
+
+				// the linker works out where it actually points to
+				Assembler_Section.Symbols = append(Assembler_Section.Symbols, object.Symbol{
+					Name:   labelName,
+					Offset: outputIndex,
+					File:   fileBase,
+					Line:   lineNumber,
+				})
+			} else {
+				// parse it character-by-character
+				buf := ""
+				instruction := Instruction{}
+				foundAnInstruction := false
+				inAString := false
+				nesting := 0
+
+				for i := 0; i < len(line); i++ {
+					char := line[i]
+					if (char == ' ' || char == '\t') && instruction.Mnemonic == "" {
+						// yay we have a mnemonic
+						instruction.Mnemonic = strings.ToUpper(buf)
+						foundAnInstruction = true
+						buf = ""
+					} else if char == '"' {
+						inAString = !inAString
+						buf += string(char)
+					} else if (char == '(' || char == ')') && !inAString {
+						// commas inside of parentheses are part of a function call, like MIN(a, b)
+						if char == '(' {
+							nesting++
+						} else {
+							nesting--
+						}
+						buf += string(char)
+					} else if char == ',' && foundAnInstruction && !inAString && nesting == 0 {
+						// yay we have an operand
+						instruction.Operands = append(instruction.Operands, buf)
+						foundAnInstruction = true
+						buf = ""
+					} else {
+						buf += string(char)
+					}
+				}
+				if !foundAnInstruction && buf != "" {
+					// it's an instruction with no operands
+					foundAnInstruction = true
+					instruction.Mnemonic = strings.ToUpper(buf)
+					buf = ""
+				}
+				if foundAnInstruction {
+					if buf != "" {
+						// add any extra as the last operand
+						instruction.Operands = append(instruction.Operands, buf)
+					}
+
+					// now, actually assemble the instruction
+					outputIndex = Assembler_AssembleInstruction(instruction, outputIndex, pass, fileBase, lineNumber)
+				}
+			}
+		}
+	}
+
+	Assembler_IncludeStack = append(Assembler_IncludeStack, filePath)
+	Macros_ExpandLines(Assembler_ReadFile(filePath, fileBase), pass, 0, func(sourceLine SourceLine) {
+		// keep track of where every line's output goes, for the listing
+		startSection := Assembler_Section
+		startIndex := outputIndex
+		listingIndex := len(Assembler_Object.Listing)
+		Assembler_Object.Listing = append(Assembler_Object.Listing, object.ListingLine{
+			Offset: outputIndex,
+			File:   sourceLine.FileBase,
+			Line:   sourceLine.LineNumber,
+			Text:   sourceLine.Text,
+		})
+
+		handleLine(sourceLine)
+
+		listingLine := &Assembler_Object.Listing[listingIndex]
+		if Assembler_Section != startSection {
+			// it started a new section, so it's at the start of that
+			listingLine.Offset = outputIndex
+		} else if !strings.HasPrefix(sourceLine.Text, ".incasm") {
+			// included files have their own lines
+			listingLine.Size = outputIndex - startIndex
+		}
+		if Assembler_Section != nil {
+			listingLine.Section = Assembler_Section.Name
+		}
+	})
+	Assembler_IncludeStack = Assembler_IncludeStack[:len(Assembler_IncludeStack)-1]
+
+	return outputIndex
+}
+
+// Assembler_FindFile returns the path of a file that's used by a file in the given directory.
+// It looks in that directory first, and then in each of the include paths.
+func Assembler_FindFile(fileName string, directory string, fileBase string, lineNumber int) string {
+	directories := append([]string{directory}, Assembler_IncludePaths...)
+	for _, searchDirectory := range directories {
+		filePath := path.Join(searchDirectory, fileName)
+		if _, err := fs.Stat(Assembler_FS, filePath); err == nil {
+			return filePath
+		}
+	}
+	diagnostics.Fatalf(fileBase, lineNumber, "Couldn't find file '%s' in '%s'", fileName, strings.Join(directories, "', '"))
+	return ""
+}
+
+// Assembler_AddDependency records that the given file was used, if it hasn't been already.
+func Assembler_AddDependency(filePath string) {
+	if !utils.StringInSlice(filePath, Assembler_Dependencies) {
+		Assembler_Dependencies = append(Assembler_Dependencies, filePath)
+	}
+}
+
+// Assembler_FindIncludedSource handles the argument of an .incasm directive, returning the path of the file to include.
+// It returns false if the file should be skipped, because it has a .once directive and was already included.
+func Assembler_FindIncludedSource(argument string, directory string, fileBase string, lineNumber int) (string, bool) {
+	fileName := strings.Replace(strings.TrimSpace(argument), "\"", "", -1)
+	if fileName == "" {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected file name")
+	}
+	filePath := Assembler_FindFile(fileName, directory, fileBase, lineNumber)
+	if Assembler_OnceFiles[filePath] {
+		return filePath, false
+	}
+	for i, includingFilePath := range Assembler_IncludeStack {
+		if includingFilePath == filePath {
+			chain := append(append([]string{}, Assembler_IncludeStack[i:]...), filePath)
+			diagnostics.Fatalf(fileBase, lineNumber, "Include cycle: %s", strings.Join(chain, " includes "))
+		}
+	}
+	return filePath, true
+}
+
+// Assembler_IsLocalLabel returns true if the given name is a local label, like .loop or @loop.
+func Assembler_IsLocalLabel(name string) bool {
+	return len(name) > 1 && (name[0] == '.' || name[0] == '@')
+}
+
+// Assembler_DeclareLabel returns the full name of a label that's being declared.
+// Global labels start a new scope, and local labels get the name of that scope in front of them, like Parent.loop.
+func Assembler_DeclareLabel(name string, fileBase string, lineNumber int) string {
+	if Assembler_IsLocalLabel(name) {
+		return Assembler_GetFullLabelName(name, fileBase, lineNumber)
+	}
+	if strings.Contains(name, ".") {
+		diagnostics.Fatalf(fileBase, lineNumber, "Global label '%s' can't have a '.' in it", name)
+	}
+	Assembler_ScopeLabel = name
+	return name
+}
+
+// Assembler_GetFullLabelName returns the full name of the given local label, in the current scope.
+func Assembler_GetFullLabelName(name string, fileBase string, lineNumber int) string {
+	if Assembler_ScopeLabel == "" {
+		diagnostics.Fatalf(fileBase, lineNumber, "Local label '%s' has no global label before it", name)
+	}
+	return Assembler_ScopeLabel + "." + name[1:]
+}
+
+// Assembler_ExpandLocalLabels replaces any local labels in the given expression with their full names.
+func Assembler_ExpandLocalLabels(expression string, fileBase string, lineNumber int) string {
+	result := ""
+	quote := byte(0)
+	for i := 0; i < len(expression); i++ {
+		char := expression[i]
+		if quote != 0 {
+			if char == quote {
+				quote = 0
+			}
+		} else if char == '"' || char == '\'' {
+			quote = char
+		} else if (char == '.' || char == '@') && (i == 0 || !Macros_IsNameCharacter(expression[i-1])) &&
+			i+1 < len(expression) && Macros_IsNameCharacter(expression[i+1]) && !(expression[i+1] >= '0' && expression[i+1] <= '9') {
+			// it's the start of a local label
+			nameEnd := i + 1
+			for nameEnd < len(expression) && Macros_IsNameCharacter(expression[nameEnd]) {
+				nameEnd++
+			}
+			result += Assembler_GetFullLabelName(expression[i:nameEnd], fileBase, lineNumber)
+			i = nameEnd - 1
+			continue
+		}
+		result += string(char)
+	}
+	return result
+}
+
+// Assembler_GetConstant evaluates the given expression, which can't refer to any labels.
+func Assembler_GetConstant(expression string, pass int, fileBase string, lineNumber int) int {
+	if parser.ReferencesSymbols(expression) {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected constant, got '%s'", expression)
+	}
+	val, valid := parser.ParseNumber(parser.SimplifyPotentialExpression(expression, pass, fileBase, lineNumber))
+	if !valid {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", expression)
+	}
+	return val
+}
+
+// Assembler_StartSection switches to the section with the given name, creating it if it doesn't exist yet.
+func Assembler_StartSection(name string, sectionType string, bank int, address int, fileBase string, lineNumber int) *object.Section {
+	section := Assembler_Object.FindSection(name)
+	if section != nil {
+		if section.Type != sectionType || section.Bank != bank || section.Address != address {
+			diagnostics.Fatalf(fileBase, lineNumber, "Section '%s' was already declared differently", name)
+		}
+		return section
+	}
+
+	section = &object.Section{
+		Name:    name,
+		Type:    sectionType,
+		Bank:    bank,
+		Address: address,
+		File:    fileBase,
+		Line:    lineNumber,
+	}
+	Assembler_Object.Sections = append(Assembler_Object.Sections, section)
+	return section
+}
+
+// Assembler_ParseSectionDirective handles a line like .section "name", ROMX[0x4000], BANK[2]
+// The address and bank are optional, if they're missing the linker picks them.
+func Assembler_ParseSectionDirective(line string, pass int, fileBase string, lineNumber int) *object.Section {
+	parts := strings.Split(strings.TrimSpace(line[len(".section"):]), ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected section name and type")
+	}
+
+	name := strings.TrimSpace(parts[0])
+	if len(name) < 2 || name[0] != '"' || name[len(name)-1] != '"' {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected section name in quotes, got '%s'", name)
+	}
+	name = name[1 : len(name)-1]
+
+	sectionType, addressExpression := Assembler_SplitBracketedArgument(parts[1], fileBase, lineNumber)
+	sectionType = strings.ToUpper(sectionType)
+	typeInfo, ok := object.SectionTypes[sectionType]
+	if !ok {
+		diagnostics.Fatalf(fileBase, lineNumber, "Unknown section type '%s'", sectionType)
+	}
+
+	address := object.Unspecified
+	if addressExpression != "" {
+		address = Assembler_GetConstant(addressExpression, pass, fileBase, lineNumber)
+		if address < typeInfo.Start || address >= typeInfo.End {
+			diagnostics.Fatalf(fileBase, lineNumber, "Address 0x%X is not in %s", address, sectionType)
+		}
+	}
+
+	bank := 0
+	if typeInfo.IsBanked {
+		bank = object.Unspecified
+	}
+	if len(parts) == 3 {
+		option, bankExpression := Assembler_SplitBracketedArgument(parts[2], fileBase, lineNumber)
+		if strings.ToUpper(option) != "BANK" || bankExpression == "" {
+			diagnostics.Fatalf(fileBase, lineNumber, "Expected BANK[number], got '%s'", strings.TrimSpace(parts[2]))
+		}
+		if !typeInfo.IsBanked {
+			diagnostics.Fatalf(fileBase, lineNumber, "Sections of type %s can't have a bank", sectionType)
+		}
+		bank = Assembler_GetConstant(bankExpression, pass, fileBase, lineNumber)
+		if bank < typeInfo.FirstBank {
+			diagnostics.Fatalf(fileBase, lineNumber, "Bank %d is not a switchable bank", bank)
+		}
+	}
+
+	return Assembler_StartSection(name, sectionType, bank, address, fileBase, lineNumber)
+}
+
+// Assembler_SplitBracketedArgument splits something like ROMX[0x4000] into ROMX and 0x4000.
+func Assembler_SplitBracketedArgument(argument string, fileBase string, lineNumber int) (string, string) {
+	argument = strings.TrimSpace(argument)
+	bracketIndex := strings.Index(argument, "[")
+	if bracketIndex == -1 {
+		return argument, ""
+	}
+	if argument[len(argument)-1] != ']' {
+		diagnostics.Fatalf(fileBase, lineNumber, "Missing ']' in '%s'", argument)
+	}
+	return strings.TrimSpace(argument[:bracketIndex]), argument[bracketIndex+1 : len(argument)-1]
+}
+
+// Assembler_ProcessOperands simplifies any expressions in the operands of the given instruction.
+func Assembler_ProcessOperands(instruction Instruction, pass int, fileBase string, lineNumber int) Instruction {
+	result := Instruction{instruction.Mnemonic, make([]string, len(instruction.Operands))}
+	for i := 0; i < len(instruction.Operands); i++ {
+		result.Operands[i] = parser.SimplifyPotentialExpression(instruction.Operands[i], pass, fileBase, lineNumber)
+
+		if utils.StringInSlice(strings.ToUpper(result.Operands[i]), append(append(parser.RegisterNames8, parser.RegisterNames16...), parser.ConditionCodes...)) {
+			// capitalize register and condition code names
+			result.Operands[i] = strings.ToUpper(result.Operands[i])
+		}
+	}
+	return result
+}
+
+// Assembler_IsRelocation returns true if the given instruction can only be assembled once the linker has placed everything.
+func Assembler_IsRelocation(instruction Instruction) bool {
+	if instruction.Mnemonic == "JR" {
+		// the offset depends on where the JR itself ends up
+		return true
+	}
+	for _, operand := range instruction.Operands {
+		if parser.ReferencesSymbols(operand) {
+			return true
+		}
+	}
+	return false
+}
+
+func Assembler_AssembleInstruction(instruction Instruction, outputIndex int, pass int, fileBase string, lineNumber int) int {
+	if instruction.Mnemonic == "DS" {
+		// it doesn't assemble to anything, so it can go in RAM
+		return Assembler_Reserve(instruction.Operands, outputIndex, pass, fileBase, lineNumber)
+	}
+
+	description := "Instruction '" + instruction.Mnemonic + "'"
+	Assembler_CheckCanOutput(description, fileBase, lineNumber)
+
+	operands := make([]string, len(instruction.Operands))
+	for i, operand := range instruction.Operands {
+		operands[i] = Assembler_ExpandLocalLabels(strings.TrimSpace(operand), fileBase, lineNumber)
+	}
+	instruction = Instruction{instruction.Mnemonic, operands}
+
+	isRelocation := Assembler_IsRelocation(instruction)
+	outputPass := pass
+	if isRelocation {
+		// assemble it with placeholders for now, just to find the size
+		outputPass = 0
+	}
+	output := OpCodes_GetOutput(Assembler_ProcessOperands(instruction, pass, fileBase, lineNumber), 0, outputPass, fileBase, lineNumber)
+	Assembler_CheckOutputFits(description, outputIndex, len(output), fileBase, lineNumber)
+
+	if isRelocation {
+		Assembler_Section.Relocations = append(Assembler_Section.Relocations, object.Relocation{
+			Offset:   outputIndex,
+			Size:     len(output),
+			Mnemonic: instruction.Mnemonic,
+			Operands: operands,
+			File:     fileBase,
+			Line:     lineNumber,
+		})
+	}
+
+	Assembler_Section.Data = append(Assembler_Section.Data, output...)
+	Assembler_Section.Size += len(output)
+	return outputIndex + len(output)
+}
+
+// Assembler_Reserve handles the arguments of a ds, .res, or .fill directive, which reserves the given number of bytes.
+// In RAM that's space for variables, and in ROM it's filled with the value after the count, or zeros.
+func Assembler_Reserve(arguments []string, outputIndex int, pass int, fileBase string, lineNumber int) int {
+	if Assembler_Section == nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "Reserved space is not in a section")
+	}
+	if len(arguments) == 0 || len(arguments) > 2 || strings.TrimSpace(arguments[0]) == "" {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected number of bytes to reserve, and the value to fill them with")
+	}
+	count := Assembler_GetConstant(arguments[0], pass, fileBase, lineNumber)
+	if count < 0 {
+		diagnostics.Fatalf(fileBase, lineNumber, "Can't reserve %d bytes", count)
+	}
+	return Assembler_Pad(count, Assembler_GetFillValue(arguments, 1, pass, fileBase, lineNumber), outputIndex, fileBase, lineNumber)
+}
+
+// Assembler_Align handles the arguments of an .align directive, which pads the output until the address is a multiple of the given number.
+func Assembler_Align(arguments []string, outputIndex int, pass int, fileBase string, lineNumber int) int {
+	if Assembler_Section == nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "Alignment is not in a section")
+	}
+	if len(arguments) == 0 || len(arguments) > 2 || strings.TrimSpace(arguments[0]) == "" {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected alignment, and the value to pad with")
+	}
+	alignment := Assembler_GetConstant(arguments[0], pass, fileBase, lineNumber)
+	if alignment < 1 || alignment > rom.BankSize || alignment&(alignment-1) != 0 {
+		diagnostics.Fatalf(fileBase, lineNumber, "Alignment must be a power of two up to 0x%X, got %d", rom.BankSize, alignment)
+	}
+	value := Assembler_GetFillValue(arguments, 1, pass, fileBase, lineNumber)
+
+	position := outputIndex
+	if Assembler_Section.Address != object.Unspecified {
+		position += Assembler_Section.Address
+	} else if alignment > Assembler_Section.Align {
+		// the linker has to put the section somewhere that's aligned too
+		Assembler_Section.Align = alignment
+	}
+	return Assembler_Pad((alignment-position%alignment)%alignment, value, outputIndex, fileBase, lineNumber)
+}
+
+// Assembler_PadTo handles the arguments of a .padto directive, which pads the output until it gets to the given address.
+func Assembler_PadTo(arguments []string, outputIndex int, pass int, fileBase string, lineNumber int) int {
+	if Assembler_Section == nil || Assembler_Section.Address == object.Unspecified {
+		diagnostics.Fatalf(fileBase, lineNumber, ".padto can only be used in a section with a fixed address")
+	}
+	if len(arguments) == 0 || len(arguments) > 2 || strings.TrimSpace(arguments[0]) == "" {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected address, and the value to pad with")
+	}
+	address := Assembler_GetConstant(arguments[0], pass, fileBase, lineNumber)
+	currentAddress := Assembler_Section.Address + outputIndex
+	if address < currentAddress {
+		diagnostics.Fatalf(fileBase, lineNumber, "Can't pad to 0x%X, the output is already at 0x%X", address, currentAddress)
+	}
+	return Assembler_Pad(address-currentAddress, Assembler_GetFillValue(arguments, 1, pass, fileBase, lineNumber), outputIndex, fileBase, lineNumber)
+}
+
+// Assembler_GetFillValue returns the byte in the given argument to pad with, or 0 if there isn't one.
+func Assembler_GetFillValue(arguments []string, index int, pass int, fileBase string, lineNumber int) byte {
+	if index >= len(arguments) {
+		return 0
+	}
+	if object.SectionTypes[Assembler_Section.Type].IsRAM {
+		diagnostics.Fatalf(fileBase, lineNumber, "Space in a RAM section can't be filled with a value")
+	}
+	value := Assembler_GetConstant(arguments[index], pass, fileBase, lineNumber)
+	OpCodes_EnsureNumberIsByte(value, fileBase, lineNumber)
+	return byte(value)
+}
+
+// Assembler_Pad adds the given number of bytes to the current section. In ROM they're filled with the value.
+func Assembler_Pad(count int, value byte, outputIndex int, fileBase string, lineNumber int) int {
+	if object.SectionTypes[Assembler_Section.Type].IsRAM {
+		Assembler_CheckOutputFits("Reserved space", outputIndex, count, fileBase, lineNumber)
+		Assembler_Section.Size += count
+		return outputIndex + count
+	}
+	return Assembler_OutputData("Reserved space", bytes.Repeat([]byte{value}, count), outputIndex, fileBase, lineNumber)
+}
+
+// Assembler_Assert handles the arguments of an .assert directive, which reports an error if the condition is 0.
+// Conditions that refer to labels are checked by the linker, once it knows where they are.
+func Assembler_Assert(arguments []string, pass int, fileBase string, lineNumber int) {
+	if len(arguments) == 0 || len(arguments) > 2 || strings.TrimSpace(arguments[0]) == "" {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected condition and message")
+	}
+	assertion := object.Assertion{
+		Expression: Assembler_ExpandLocalLabels(strings.TrimSpace(arguments[0]), fileBase, lineNumber),
+		File:       fileBase,
+		Line:       lineNumber,
+	}
+	if len(arguments) == 2 {
+		assertion.Message = Assembler_GetQuotedArgument(arguments[1], "message", fileBase, lineNumber)
+	}
+
+	if parser.ReferencesSymbols(assertion.Expression) {
+		Assembler_Object.Assertions = append(Assembler_Object.Assertions, assertion)
+		return
+	}
+	Assembler_CheckAssertion(assertion, pass)
+}
+
+// Assembler_CheckAssertion reports an error if the condition of the given assertion is 0.
+func Assembler_CheckAssertion(assertion object.Assertion, pass int) {
+	if Assembler_GetConstant(assertion.Expression, pass, assertion.File, assertion.Line) != 0 {
+		return
+	}
+	if assertion.Message != "" {
+		diagnostics.Fatalf(assertion.File, assertion.Line, "Assertion failed: %s", assertion.Message)
+	}
+	diagnostics.Fatalf(assertion.File, assertion.Line, "Assertion failed: %s", assertion.Expression)
+}
+
+// Assembler_CheckCanOutput makes sure that there's a ROM section for the given thing to go into.
+func Assembler_CheckCanOutput(description string, fileBase string, lineNumber int) {
+	if Assembler_Section == nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "%s is not in a section", description)
+	}
+	if object.SectionTypes[Assembler_Section.Type].IsRAM {
+		diagnostics.Fatalf(fileBase, lineNumber, "%s can't be in a RAM section", description)
+	}
+}
+
+// Assembler_CheckOutputFits makes sure that the given number of bytes fit into the current section at outputIndex.
+func Assembler_CheckOutputFits(description string, outputIndex int, size int, fileBase string, lineNumber int) {
+	typeInfo := object.SectionTypes[Assembler_Section.Type]
+	maxSize := typeInfo.End - typeInfo.Start
+	if Assembler_Section.Address != object.Unspecified {
+		end := typeInfo.End
+		if Assembler_Section.Type == "ROM0" {
+			// going from bank 0 to bank 1 is fine, the CPU sees those as one continuous area
+			end = 2 * rom.BankSize
+		}
+		maxSize = end - Assembler_Section.Address
+	}
+	if outputIndex+size > maxSize {
+		diagnostics.Fatalf(fileBase, lineNumber, "%s goes past the end of %s", description, Assembler_Section.Type)
+	}
+	if Assembler_Section.MaxSize > 0 && outputIndex+size > Assembler_Section.MaxSize {
+		diagnostics.Fatalf(fileBase, lineNumber, "%s goes past the end of %s, which can only be %d bytes", description, Assembler_Section.Name, Assembler_Section.MaxSize)
+	}
+}
+
+// Assembler_IncludeBinary handles the arguments of an .incbin directive, copying the bytes of a file into the current section.
+// The arguments are the file name, and optionally an offset into the file and the number of bytes to copy.
+func Assembler_IncludeBinary(arguments string, directory string, outputIndex int, pass int, fileBase string, lineNumber int) int {
+	parts := Macros_SplitArguments(strings.TrimSpace(arguments))
+	if len(parts) > 3 {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected file name, offset, and length, got %d arguments", len(parts))
+	}
+	fileName := Assembler_GetQuotedArgument(parts[0], "file name", fileBase, lineNumber)
+	description := "Binary file '" + fileName + "'"
+	Assembler_CheckCanOutput(description, fileBase, lineNumber)
+
+	filePath := Assembler_FindFile(fileName, directory, fileBase, lineNumber)
+	data, err := fs.ReadFile(Assembler_FS, filePath)
+	if err != nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "Couldn't open file: %s", err)
+	}
+	Assembler_AddDependency(filePath)
+
+	offset := 0
+	if len(parts) > 1 {
+		offset = Assembler_GetConstant(parts[1], pass, fileBase, lineNumber)
+		if offset < 0 || offset > len(data) {
+			diagnostics.Fatalf(fileBase, lineNumber, "Offset %d is outside of '%s', which is %d bytes long", offset, fileName, len(data))
+		}
+	}
+	length := len(data) - offset
+	if len(parts) > 2 {
+		length = Assembler_GetConstant(parts[2], pass, fileBase, lineNumber)
+		if length < 0 || offset+length > len(data) {
+			diagnostics.Fatalf(fileBase, lineNumber, "Can't include %d bytes from offset %d of '%s', which is %d bytes long", length, offset, fileName, len(data))
+		}
+	}
+	return Assembler_OutputData(description, data[offset:offset+length], outputIndex, fileBase, lineNumber)
+}
+
+// Assembler_IncludeGraphics handles the arguments of an .incgfx directive, converting an image into tiles in the current section.
+// The arguments are the file name, and then any of 1BPP, 8X16, DEDUPE, TILEMAP, and PALETTE[a, b, ...].
+func Assembler_IncludeGraphics(arguments string, directory string, outputIndex int, pass int, fileBase string, lineNumber int) int {
+	parts := Macros_SplitArguments(strings.TrimSpace(arguments))
+	fileName := Assembler_GetQuotedArgument(parts[0], "file name", fileBase, lineNumber)
+	description := "Image '" + fileName + "'"
+	Assembler_CheckCanOutput(description, fileBase, lineNumber)
+
+	options := gfx.Options{}
+	outputTilemap := false
+	for _, part := range parts[1:] {
+		option, value := Assembler_SplitBracketedArgument(part, fileBase, lineNumber)
+		switch strings.ToUpper(option) {
+		case "1BPP":
+			options.BitDepth = 1
+		case "8X16":
+			options.Tall = true
+		case "DEDUPE":
+			options.Deduplicate = true
+		case "TILEMAP":
+			outputTilemap = true
+		case "PALETTE":
+			options.Palette = []int{}
+			for _, shade := range Macros_SplitArguments(value) {
+				options.Palette = append(options.Palette, Assembler_GetConstant(shade, pass, fileBase, lineNumber))
+			}
+		default:
+			diagnostics.Fatalf(fileBase, lineNumber, "Unknown option '%s' for .incgfx", strings.TrimSpace(part))
+		}
+	}
+
+	filePath := Assembler_FindFile(fileName, directory, fileBase, lineNumber)
+	file, err := Assembler_FS.Open(filePath)
+	if err != nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "Couldn't open file: %s", err)
+	}
+	defer file.Close()
+	Assembler_AddDependency(filePath)
+	img, err := png.Decode(file)
+	if err != nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "Couldn't read image '%s': %s", fileName, err)
+	}
+
+	graphics, err := gfx.Convert(img, options)
+	if err != nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "Couldn't convert image '%s': %s", fileName, err)
+	}
+	if outputTilemap {
+		tilemap, err := graphics.TilemapBytes()
+		if err != nil {
+			diagnostics.Fatalf(fileBase, lineNumber, "Couldn't make tilemap for image '%s': %s", fileName, err)
+		}
+		return Assembler_OutputData(description, tilemap, outputIndex, fileBase, lineNumber)
+	}
+	return Assembler_OutputData(description, graphics.Tiles, outputIndex, fileBase, lineNumber)
+}
+
+// Assembler_OutputData adds the given bytes to the current section at outputIndex, and returns the index after them.
+func Assembler_OutputData(description string, data []byte, outputIndex int, fileBase string, lineNumber int) int {
+	Assembler_CheckOutputFits(description, outputIndex, len(data), fileBase, lineNumber)
+	Assembler_Section.Data = append(Assembler_Section.Data, data...)
+	Assembler_Section.Size += len(data)
+	return outputIndex + len(data)
+}
+
+// Assembler_GetQuotedArgument returns what's in the given argument, which should be in quotes.
+// The description says what the argument is, for the error if it isn't quoted.
+func Assembler_GetQuotedArgument(argument string, description string, fileBase string, lineNumber int) string {
+	argument = strings.TrimSpace(argument)
+	if len(argument) < 2 || argument[0] != '"' || argument[len(argument)-1] != '"' {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected %s in quotes, got '%s'", description, argument)
+	}
+	return argument[1 : len(argument)-1]
+}
@@ -0,0 +1,308 @@
+package assembler
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"testing/fstest"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func TestLocalLabels(t *testing.T) {
+	Assembler_ScopeLabel = ""
+	if name := Assembler_DeclareLabel("parent", "test.s", 1); name != "parent" {
+		t.Errorf("Global label was declared as '%s'", name)
+	}
+	if name := Assembler_DeclareLabel(".loop", "test.s", 2); name != "parent.loop" {
+		t.Errorf("Local label was declared as '%s', should have been 'parent.loop'", name)
+	}
+	if name := Assembler_DeclareLabel("@done", "test.s", 3); name != "parent.done" {
+		t.Errorf("Local label was declared as '%s', should have been 'parent.done'", name)
+	}
+
+	tests := map[string]string{
+		".loop":               "parent.loop",
+		"[@done + 1]":         "[parent.done + 1]",
+		"BANK(.loop)":         "BANK(parent.loop)",
+		"other.loop":          "other.loop",
+		"\".loop\"":           "\".loop\"",
+		"'.'":                 "'.'",
+		"SP+.offset":          "SP+parent.offset",
+		"first.loop - .start": "first.loop - parent.start",
+	}
+	for expression, expected := range tests {
+		if result := Assembler_ExpandLocalLabels(expression, "test.s", 4); result != expected {
+			t.Errorf("Expanded '%s' to '%s', should have been '%s'", expression, result, expected)
+		}
+	}
+}
+
+func TestConditionalsInOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s":  &fstest.MapFile{Data: []byte(".incasm \"guard.s\"\n.incasm \"guard.s\"\n.ifdef LATER\nskipped:\n\tdb 1\n.endif\n\tdb 2\n.def LATER 1\n")},
+		"guard.s": &fstest.MapFile{Data: []byte(".ifndef GUARD\n.def GUARD 1\nstart:\n\tdb 0xAA\n.endif\n")},
+	}
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := result.ROM[0x150:0x153]; !bytes.Equal(output, []byte{0xAA, 2, 0}) {
+		t.Errorf("Output was % X", output)
+	}
+	if _, exists := result.Labels["start"]; !exists {
+		t.Errorf("Label 'start' is missing")
+	}
+	if _, exists := result.Labels["skipped"]; exists {
+		t.Errorf("Label 'skipped' shouldn't exist")
+	}
+
+	// DEF() works the same way
+	fsys["main.s"] = &fstest.MapFile{Data: []byte("\tdb DEF(LATER)\n.if DEF(LATER)\nskipped:\n\tdb 1\n.endif\n.def LATER 1\n\tdb DEF(LATER)\n")}
+	result, err = Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := result.ROM[0x150:0x153]; !bytes.Equal(output, []byte{0, 1, 0}) {
+		t.Errorf("Output was % X", output)
+	}
+	if _, exists := result.Labels["skipped"]; exists {
+		t.Errorf("Label 'skipped' shouldn't exist")
+	}
+}
+
+func TestDirectivesWithoutArguments(t *testing.T) {
+	directives := []string{
+		".def", ".org", ".bank", ".section", ".vector", ".incasm", ".incbin", ".incgfx", ".res", ".fill", ".align", ".padto", ".assert",
+		".macro", ".endm", ".rept", ".endr", ".irp", ".if", ".elif", ".else", ".endif", ".ifdef", ".ifndef", "ds",
+	}
+	for _, directive := range directives {
+		fsys := fstest.MapFS{"main.s": &fstest.MapFile{Data: []byte("\t" + directive + "\n")}}
+		if _, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}}); err == nil {
+			t.Errorf("Assembling '%s' without any arguments should have failed", directive)
+		}
+	}
+}
+
+func TestIncludeBinary(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s":         &fstest.MapFile{Data: []byte(".incbin \"data/tiles.bin\"\n.incbin \"data/tiles.bin\", 2\n.incbin \"data/tiles.bin\", 1, 2\nafter:\n\tdb SIZEOF(\"main.s\")\n")},
+		"data/tiles.bin": &fstest.MapFile{Data: []byte{1, 2, 3, 4}},
+	}
+
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{1, 2, 3, 4, 3, 4, 2, 3, 9}
+	if output := result.ROM[0x150 : 0x150+len(expected)]; !bytes.Equal(output, expected) {
+		t.Errorf("Output was % X, should have been % X", output, expected)
+	}
+	if result.Labels["after"] != (rom.Label{Bank: 0, Address: 0x158}) {
+		t.Errorf("Label 'after' was at %+v", result.Labels["after"])
+	}
+
+	for _, line := range []string{".incbin \"data/tiles.bin\", 5", ".incbin \"data/tiles.bin\", 2, 3", ".incbin \"missing.bin\"", ".incbin data/tiles.bin"} {
+		fsys["main.s"] = &fstest.MapFile{Data: []byte(line + "\n")}
+		if _, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}}); err == nil {
+			t.Errorf("Assembling '%s' should have failed", line)
+		}
+	}
+}
+
+func TestIncludePaths(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/main.s":      &fstest.MapFile{Data: []byte(".incasm \"local.s\"\n.incasm \"hardware.s\"\n.incbin \"font.bin\"\n")},
+		"src/local.s":     &fstest.MapFile{Data: []byte("\tdb 1\n")},
+		"src/hardware.s":  &fstest.MapFile{Data: []byte("\tdb 2\n")},
+		"lib/hardware.s":  &fstest.MapFile{Data: []byte("\tdb 3\n")},
+		"lib/math.s":      &fstest.MapFile{Data: []byte(".incasm \"helpers.s\"\n")},
+		"lib/helpers.s":   &fstest.MapFile{Data: []byte("\tdb 4\n")},
+		"shared/font.bin": &fstest.MapFile{Data: []byte{5}},
+		"shared/local.s":  &fstest.MapFile{Data: []byte("\tdb 6\n")},
+		"shared/unused.s": &fstest.MapFile{Data: []byte("\tdb 7\n")},
+	}
+	options := Options{Info: &rom.Info{Name: "TEST", IncludePaths: []string{"shared"}}, IncludePaths: []string{"lib"}}
+
+	// files next to the one including them come first, then the include paths from the options, and then the ones from the info
+	result, err := Assemble(fsys, "src/main.s", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := result.ROM[0x150:0x153]; !bytes.Equal(output, []byte{1, 2, 5}) {
+		t.Errorf("Output was % X", output)
+	}
+
+	// files found in an include path can include things next to them
+	fsys["src/main.s"] = &fstest.MapFile{Data: []byte(".incasm \"math.s\"\n")}
+	result, err = Assemble(fsys, "src/main.s", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ROM[0x150] != 4 {
+		t.Errorf("Output was %X", result.ROM[0x150])
+	}
+
+	fsys["src/main.s"] = &fstest.MapFile{Data: []byte(".incasm \"missing.s\"\n")}
+	_, err = Assemble(fsys, "src/main.s", options)
+	if err == nil || err.Error() != "main.s:1:1: error: Couldn't find file 'missing.s' in 'src', 'lib', 'shared'" {
+		t.Errorf("Error was '%v'", err)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s":  &fstest.MapFile{Data: []byte(".incasm \"a.s\"\n")},
+		"a.s":     &fstest.MapFile{Data: []byte("\tnop\n.incasm \"lib/b.s\"\n")},
+		"lib/b.s": &fstest.MapFile{Data: []byte(".incasm \"../a.s\"\n")},
+	}
+	_, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err == nil || err.Error() != "b.s:1:1: error: Include cycle: a.s includes lib/b.s includes a.s" {
+		t.Errorf("Error was '%v'", err)
+	}
+
+	fsys["main.s"] = &fstest.MapFile{Data: []byte("\tnop\n.incasm \"main.s\"\n")}
+	_, err = Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err == nil || err.Error() != "main.s:2:1: error: Include cycle: main.s includes main.s" {
+		t.Errorf("Error was '%v'", err)
+	}
+}
+
+func TestIncludeOnce(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s":         &fstest.MapFile{Data: []byte(".incasm \"sprites.s\"\n.incasm \"sound.s\"\n.incasm \"lib/hardware.s\"\n\tdb COUNT\n")},
+		"sprites.s":      &fstest.MapFile{Data: []byte(".incasm \"lib/hardware.s\"\n\tdb 1\n")},
+		"sound.s":        &fstest.MapFile{Data: []byte(".incasm \"lib/hardware.s\"\n\tdb 2\n")},
+		"lib/hardware.s": &fstest.MapFile{Data: []byte(".once\n.def COUNT 3\n.macro wait\n\tnop\n.endm\nhardware:\n\tdb 0\n")},
+	}
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := result.ROM[0x150:0x154]; !bytes.Equal(output, []byte{0, 1, 2, 3}) {
+		t.Errorf("Output was % X", output)
+	}
+
+	// a file that includes itself is fine with .once
+	fsys["main.s"] = &fstest.MapFile{Data: []byte(".once\n\tdb 1\n.incasm \"main.s\"\n")}
+	result, err = Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := result.ROM[0x150:0x152]; !bytes.Equal(output, []byte{1, 0}) {
+		t.Errorf("Output was % X", output)
+	}
+}
+
+func TestIncludeGraphics(t *testing.T) {
+	// two tiles, the first one all color 3 and the second one the same
+	img := image.NewPaletted(image.Rect(0, 0, 16, 8), color.Palette{color.White, color.White, color.Black, color.Black})
+	for i := range img.Pix {
+		img.Pix[i] = 3
+	}
+	var imageData bytes.Buffer
+	if err := png.Encode(&imageData, img); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{
+		"main.s":         &fstest.MapFile{Data: []byte("tiles:\n.incgfx \"gfx/sprite.png\", DEDUPE, PALETTE[0, 1, 2, 1]\nmap:\n.incgfx \"gfx/sprite.png\", dedupe, tilemap\n")},
+		"gfx/sprite.png": &fstest.MapFile{Data: imageData.Bytes()},
+	}
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(bytes.Repeat([]byte{0xFF, 0x00}, 8), 0x00, 0x00)
+	if output := result.ROM[0x150 : 0x150+len(expected)]; !bytes.Equal(output, expected) {
+		t.Errorf("Output was % X, should have been % X", output, expected)
+	}
+	if result.Labels["map"] != (rom.Label{Bank: 0, Address: 0x160}) {
+		t.Errorf("Label 'map' was at %+v", result.Labels["map"])
+	}
+
+	for _, line := range []string{".incgfx \"gfx/sprite.png\", 8x16", ".incgfx \"gfx/sprite.png\", sideways", ".incgfx \"main.s\""} {
+		fsys["main.s"] = &fstest.MapFile{Data: []byte(line + "\n")}
+		if _, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}}); err == nil {
+			t.Errorf("Assembling '%s' should have failed", line)
+		}
+	}
+}
+
+func TestPadding(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s": &fstest.MapFile{Data: []byte(`
+	nop
+	ds 2, 0xFF
+	.fill 1, -1
+	.align 8
+	db 1
+	.padto 0x15A, $AA
+aligned:
+	db 2
+.section "table", ROMX
+	db 3
+	.align 0x100
+table:
+	db 4
+	.assert (table & 0xFF) == 0, "table isn't aligned"
+	.assert SIZEOF("table") == 0x101
+	.assert 2 + 2 == 4
+`)},
+	}
+
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST", MBC: "MBC5", ROMSize: 64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0x01, 0xAA, 0x02}
+	if output := result.ROM[0x150 : 0x150+len(expected)]; !bytes.Equal(output, expected) {
+		t.Errorf("Output was % X, should have been % X", output, expected)
+	}
+	if result.Labels["aligned"] != (rom.Label{Bank: 0, Address: 0x15A}) {
+		t.Errorf("Label 'aligned' was at %+v", result.Labels["aligned"])
+	}
+	if table := result.Labels["table"]; table.Address&0xFF != 0 {
+		t.Errorf("Label 'table' was at %+v, which isn't aligned", table)
+	}
+
+	errorTests := []string{
+		"\tnop\n\t.padto 0x150",
+		".section \"floating\", ROM0\n\t.padto 0x200",
+		"\t.align 3",
+		"\t.align 0x8000",
+		".section \"ram\", WRAM0\n\tds 1, 0",
+		"\t.assert 1 == 2",
+		"\t.assert 0, \"should fail\"",
+		"label:\n\t.assert label == 0",
+		"\t.assert 1, message",
+		"\tds",
+	}
+	for _, source := range errorTests {
+		fsys["main.s"] = &fstest.MapFile{Data: []byte(source + "\n")}
+		if _, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST"}}); err == nil {
+			t.Errorf("Assembling '%s' should have failed", source)
+		}
+	}
+
+	// the directives always pass at least one argument, but the helpers shouldn't rely on that
+	Assembler_Section = &object.Section{Name: "test", Type: "ROM0", Bank: 0, Address: 0x150}
+	defer func() { Assembler_Section = nil }()
+	helpers := map[string]func(){
+		"Assembler_Reserve": func() { Assembler_Reserve(nil, 0, 1, "test.s", 1) },
+		"Assembler_Align":   func() { Assembler_Align(nil, 0, 1, "test.s", 1) },
+		"Assembler_PadTo":   func() { Assembler_PadTo(nil, 0, 1, "test.s", 1) },
+		"Assembler_Assert":  func() { Assembler_Assert(nil, 1, "test.s", 1) },
+	}
+	for name, helper := range helpers {
+		diagnostics.Reset()
+		if diagnostics.Try("test.s", 1, 0, helper) {
+			t.Errorf("%s without any arguments should have failed", name)
+		}
+	}
+	diagnostics.Reset()
+}
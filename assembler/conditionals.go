@@ -0,0 +1,99 @@
+package assembler
+
+import (
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/rom"
+	"github.com/thatoddmailbox/gbasm/utils"
+)
+
+// a conditionalBlock is an .if that hasn't reached its .endif yet
+type conditionalBlock struct {
+	parentActive bool // false if the whole block is inside of a skipped block
+	active       bool // true if the lines right now should be assembled
+	taken        bool // true if one of the branches has been assembled already
+	sawElse      bool
+	line         SourceLine
+}
+
+// Conditionals_HandleLine handles the given line if it's a conditional directive, or if it's in a block that's being skipped.
+// It returns true if the line was handled, and shouldn't be assembled.
+func Conditionals_HandleLine(blocks *[]conditionalBlock, line SourceLine, pass int) bool {
+	fields := strings.Fields(line.Text)
+	directive := strings.ToLower(fields[0])
+	argument := strings.TrimSpace(line.Text[len(fields[0]):])
+
+	active := len(*blocks) == 0 || (*blocks)[len(*blocks)-1].active
+
+	switch directive {
+	case ".if", ".ifdef", ".ifndef":
+		condition := false
+		if active {
+			// only look at the condition if it matters, so that skipped blocks can refer to things that don't exist
+			condition = Conditionals_Evaluate(directive, argument, pass, line)
+		}
+		*blocks = append(*blocks, conditionalBlock{active, active && condition, active && condition, false, line})
+		return true
+
+	case ".elif", ".else":
+		if len(*blocks) == 0 {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Unexpected '%s' without .if", fields[0])
+		}
+		block := &(*blocks)[len(*blocks)-1]
+		if block.sawElse {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Unexpected '%s' after .else", fields[0])
+		}
+
+		condition := true
+		if directive == ".elif" && block.parentActive && !block.taken {
+			condition = Conditionals_Evaluate(".if", argument, pass, line)
+		}
+		block.sawElse = (directive == ".else")
+		block.active = block.parentActive && !block.taken && condition
+		block.taken = block.taken || block.active
+		return true
+
+	case ".endif":
+		if len(*blocks) == 0 {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Unexpected '.endif' without .if")
+		}
+		*blocks = (*blocks)[:len(*blocks)-1]
+		return true
+	}
+
+	return !active
+}
+
+// Conditionals_CheckClosed makes sure that every .if has a matching .endif.
+func Conditionals_CheckClosed(blocks []conditionalBlock) {
+	if len(blocks) > 0 {
+		line := blocks[len(blocks)-1].line
+		diagnostics.Errorf(line.FileBase, line.LineNumber, "Missing '.endif' for block")
+	}
+}
+
+// Conditionals_Evaluate works out whether the condition of an .if, .ifdef, or .ifndef is true.
+func Conditionals_Evaluate(directive string, argument string, pass int, line SourceLine) bool {
+	if argument == "" {
+		diagnostics.Fatalf(line.FileBase, line.LineNumber, "Expected condition after '%s'", directive)
+	}
+
+	if directive == ".if" {
+		return Assembler_GetConstant(argument, pass, line.FileBase, line.LineNumber) != 0
+	}
+
+	if Assembler_IsLocalLabel(argument) {
+		argument = Assembler_GetFullLabelName(argument, line.FileBase, line.LineNumber)
+	}
+
+	// the first pass already found every constant, so only the ones declared before this line count
+	isConstant := utils.StringInSlice(argument, rom.Current.DeclaredConstants)
+	_, isMacro := Macros_Table[strings.ToUpper(argument)]
+	isLabel := utils.StringInSlice(argument, rom.Current.UnpointedDefinitions)
+	isDefined := isConstant || isMacro || isLabel
+	if directive == ".ifndef" {
+		return !isDefined
+	}
+	return isDefined
+}
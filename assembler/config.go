@@ -0,0 +1,43 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+// ReadConfigFile reads the ROM info from the info.toml file in the given file system.
+func ReadConfigFile(fsys fs.FS) (rom.Info, error) {
+	info := rom.Info{}
+
+	fileContents, err := fs.ReadFile(fsys, "info.toml")
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, errors.New("missing info.toml file")
+	} else if err != nil {
+		return info, err
+	}
+
+	metadata, err := toml.Decode(string(fileContents), &info)
+	if err != nil {
+		return info, err
+	}
+
+	// a typo in a setting would otherwise just be ignored
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		keys := []string{}
+		for _, key := range undecoded {
+			keys = append(keys, "'"+key.String()+"'")
+		}
+		if len(keys) == 1 {
+			return info, fmt.Errorf("unknown setting %s in info.toml", keys[0])
+		}
+		return info, fmt.Errorf("unknown settings %s in info.toml", strings.Join(keys, ", "))
+	}
+
+	return info, nil
+}
@@ -0,0 +1,520 @@
+package assembler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+// A Hint marks a range of addresses in a bank as code or data, so that things like tables aren't disassembled as instructions.
+type Hint struct {
+	IsData bool
+	Bank   int
+	Start  int // first address of the range
+	End    int // last address of the range
+}
+
+// DisassemblyOptions changes how a ROM is disassembled.
+type DisassemblyOptions struct {
+	// Labels are printed where they point to, and used as the targets of jumps and calls.
+	Labels map[string]rom.Label
+
+	// Hints mark parts of the ROM as code or data. Everything is code unless a hint says otherwise, and later hints override earlier ones.
+	Hints []Hint
+}
+
+// the names of the registers and such, by their index in the encoding
+var Disassembler_Table_R = Disassembler_InvertTable(OpCodes_Table_R)
+var Disassembler_Table_RP = Disassembler_InvertTable(OpCodes_Table_RP)
+var Disassembler_Table_RP2 = Disassembler_InvertTable(OpCodes_Table_RP2)
+var Disassembler_Table_CC = Disassembler_InvertTable(OpCodes_Table_CC)
+var Disassembler_Table_ALU = Disassembler_InvertTable(OpCodes_Table_ALU)
+var Disassembler_Table_ROT = Disassembler_InvertTable(OpCodes_Table_ROT)
+
+// how many bytes of data go in each db line
+const disassemblerBytesPerLine = 8
+
+// runs of the same byte at least this long become a ds instead of being disassembled
+const disassemblerMinimumRunLength = 16
+
+// Disassembler_InvertTable turns one of the opcode tables around, so that the index in the encoding gives the name.
+func Disassembler_InvertTable(table map[string]int) []string {
+	result := make([]string, len(table))
+	for name, index := range table {
+		result[index] = strings.ToLower(name)
+	}
+	return result
+}
+
+// Disassembler_DecodeInstruction decodes the instruction at the start of data, which is at the given address.
+// The targets of jumps and calls are passed to targetName, so that they can be replaced with labels.
+// It returns the instruction, in a form that the assembler accepts, and its size, which is 0 if it isn't a valid instruction.
+func Disassembler_DecodeInstruction(data []byte, address int, targetName func(target int) string) (string, int) {
+	if len(data) == 0 {
+		return "", 0
+	}
+
+	// padding the data means the operands can be read before checking if they're all there
+	padded := append(append([]byte{}, data...), 0, 0)
+	n := int(padded[1])
+	nn := int(padded[1]) | int(padded[2])<<8
+	d := int(int8(padded[1]))
+
+	text, size := Disassembler_DecodeOpCode(int(padded[0]), n, nn, d, address, targetName)
+	if size > len(data) {
+		return "", 0
+	}
+	return text, size
+}
+
+// Disassembler_DecodeOpCode decodes one instruction, given its first byte and what the bytes after it would be as operands.
+func Disassembler_DecodeOpCode(opCode int, n int, nn int, d int, address int, targetName func(target int) string) (string, int) {
+	x, y, z := opCode>>6, (opCode>>3)&7, opCode&7
+	p, q := y>>1, y&1
+	r, rp, rp2, cc, alu := Disassembler_Table_R, Disassembler_Table_RP, Disassembler_Table_RP2, Disassembler_Table_CC, Disassembler_Table_ALU
+
+	switch x {
+	case 0:
+		switch z {
+		case 0:
+			switch y {
+			case 0:
+				return "nop", 1
+			case 1:
+				return fmt.Sprintf("ld [0x%04X], sp", nn), 3
+			case 2:
+				// the assembler always puts a 0 after STOP
+				if n != 0 {
+					return "", 0
+				}
+				return "stop", 2
+			case 3:
+				return "jr " + targetName(address+2+d), 2
+			default:
+				return fmt.Sprintf("jr %s, %s", cc[y-4], targetName(address+2+d)), 2
+			}
+
+		case 1:
+			if q == 0 {
+				return fmt.Sprintf("ld %s, 0x%04X", rp[p], nn), 3
+			}
+			return "add hl, " + rp[p], 1
+
+		case 2:
+			memory := []string{"[bc]", "[de]", "[hl+]", "[hl-]"}[p]
+			if q == 0 {
+				return fmt.Sprintf("ld %s, a", memory), 1
+			}
+			return "ld a, " + memory, 1
+
+		case 3:
+			if q == 0 {
+				return "inc " + rp[p], 1
+			}
+			return "dec " + rp[p], 1
+
+		case 4:
+			return "inc " + r[y], 1
+
+		case 5:
+			return "dec " + r[y], 1
+
+		case 6:
+			return fmt.Sprintf("ld %s, 0x%02X", r[y], n), 2
+
+		case 7:
+			return []string{"rlca", "rrca", "rla", "rra", "daa", "cpl", "scf", "ccf"}[y], 1
+		}
+
+	case 1:
+		if z == 6 && y == 6 {
+			return "halt", 1
+		}
+		return fmt.Sprintf("ld %s, %s", r[y], r[z]), 1
+
+	case 2:
+		return Disassembler_FormatALU(alu[y], r[z]), 1
+
+	case 3:
+		switch z {
+		case 0:
+			switch y {
+			case 4:
+				return fmt.Sprintf("ldh [0x%04X], a", 0xFF00+n), 2
+			case 5:
+				return fmt.Sprintf("add sp, %d", d), 2
+			case 6:
+				return fmt.Sprintf("ldh a, [0x%04X]", 0xFF00+n), 2
+			case 7:
+				return fmt.Sprintf("ld hl, sp%+d", d), 2
+			default:
+				return "ret " + cc[y], 1
+			}
+
+		case 1:
+			if q == 0 {
+				return "pop " + rp2[p], 1
+			}
+			return []string{"ret", "reti", "jp hl", "ld sp, hl"}[p], 1
+
+		case 2:
+			switch y {
+			case 4:
+				return "ld [c], a", 1
+			case 5:
+				return fmt.Sprintf("ld [0x%04X], a", nn), 3
+			case 6:
+				return "ld a, [c]", 1
+			case 7:
+				return fmt.Sprintf("ld a, [0x%04X]", nn), 3
+			default:
+				return fmt.Sprintf("jp %s, %s", cc[y], targetName(nn)), 3
+			}
+
+		case 3:
+			switch y {
+			case 0:
+				return "jp " + targetName(nn), 3
+			case 1:
+				return Disassembler_DecodePrefixed(n), 2
+			case 6:
+				return "di", 1
+			case 7:
+				return "ei", 1
+			}
+
+		case 4:
+			if y < 4 {
+				return fmt.Sprintf("call %s, %s", cc[y], targetName(nn)), 3
+			}
+
+		case 5:
+			if q == 0 {
+				return "push " + rp2[p], 1
+			}
+			if p == 0 {
+				return "call " + targetName(nn), 3
+			}
+
+		case 6:
+			return Disassembler_FormatALU(alu[y], fmt.Sprintf("0x%02X", n)), 2
+
+		case 7:
+			return fmt.Sprintf("rst 0x%02X", y*8), 1
+		}
+	}
+
+	// the ones that are left are Z80 instructions that the LR35902 doesn't have
+	return "", 0
+}
+
+// Disassembler_DecodePrefixed decodes the byte after a 0xCB prefix.
+func Disassembler_DecodePrefixed(opCode int) string {
+	x, y, z := opCode>>6, (opCode>>3)&7, opCode&7
+	register := Disassembler_Table_R[z]
+	if x == 0 {
+		return fmt.Sprintf("%s %s", Disassembler_Table_ROT[y], register)
+	}
+	return fmt.Sprintf("%s %d, %s", []string{"bit", "res", "set"}[x-1], y, register)
+}
+
+// Disassembler_FormatALU formats an arithmetic instruction. The ones that are usually written with the A register have it.
+func Disassembler_FormatALU(mnemonic string, operand string) string {
+	if mnemonic == "add" || mnemonic == "adc" || mnemonic == "sbc" {
+		return fmt.Sprintf("%s a, %s", mnemonic, operand)
+	}
+	return fmt.Sprintf("%s %s", mnemonic, operand)
+}
+
+// Disassembler_Write writes the disassembly of the given ROM, as source code that the assembler can turn back into the same ROM.
+// The cartridge header is left out, since the assembler makes that from the info.toml.
+func Disassembler_Write(writer io.Writer, output []byte, options DisassemblyOptions) error {
+	if len(output) == 0 || len(output)%rom.BankSize != 0 {
+		return errors.New("ROM size has to be a multiple of 16 KiB")
+	}
+
+	isData := make([]bool, len(output))
+	for _, hint := range options.Hints {
+		start := rom.GetOffset(hint.Bank, hint.Start)
+		end := rom.GetOffset(hint.Bank, hint.End)
+		for offset := start; offset <= end && offset < len(output); offset++ {
+			isData[offset] = hint.IsData
+		}
+	}
+
+	labelOffsets, labelLines, labelNames := Disassembler_PlaceLabels(options.Labels, len(output))
+	nextLabelIndex := 0
+
+	lines := bufio.NewWriter(writer)
+	for bank := 0; bank < len(output)/rom.BankSize; bank++ {
+		bankStart := bank * rom.BankSize
+		bankEnd := bankStart + rom.BankSize
+
+		// the unused space at the end of the bank is left out, since it's zeros anyway
+		end := bankStart
+		for offset := bankEnd - 1; offset >= bankStart; offset-- {
+			if output[offset] != 0 {
+				end = offset + 1
+				break
+			}
+		}
+		for _, labelOffset := range labelOffsets {
+			if labelOffset >= end && labelOffset < bankEnd {
+				end = labelOffset + 1
+			}
+		}
+		if end == bankStart {
+			continue
+		}
+
+		if bank == 0 {
+			fmt.Fprintln(lines, ".org 0x0000")
+		} else {
+			fmt.Fprintln(lines)
+			fmt.Fprintf(lines, ".bank %d\n", bank)
+		}
+
+		targetName := func(target int) string {
+			targetOffset := -1
+			if target < rom.BankSize {
+				targetOffset = target
+			} else if target < 2*rom.BankSize && bank > 0 {
+				targetOffset = rom.GetOffset(bank, target)
+			}
+			if name, ok := labelNames[targetOffset]; ok {
+				return name
+			}
+			return fmt.Sprintf("0x%04X", target)
+		}
+
+		for offset := bankStart; offset < end; {
+			if bank == 0 && offset == 0x100 {
+				fmt.Fprintln(lines)
+				fmt.Fprintln(lines, "; 0x0100-0x014F is the cartridge header, which gbasm makes from info.toml")
+				for _, labelOffset := range labelOffsets {
+					if labelOffset >= 0x100 && labelOffset < 0x150 {
+						for _, line := range labelLines[labelOffset] {
+							fmt.Fprintln(lines, "; "+line)
+						}
+					}
+				}
+				fmt.Fprintln(lines, ".org 0x0150")
+				offset = 0x150
+				continue
+			}
+
+			for nextLabelIndex < len(labelOffsets) && labelOffsets[nextLabelIndex] < offset {
+				nextLabelIndex++
+			}
+			for nextLabelIndex < len(labelOffsets) && labelOffsets[nextLabelIndex] == offset {
+				for _, line := range labelLines[offset] {
+					fmt.Fprintln(lines, line)
+				}
+				nextLabelIndex++
+			}
+
+			// nothing can go past the next label, the header, or the end of the bank
+			limit := end
+			if nextLabelIndex < len(labelOffsets) && labelOffsets[nextLabelIndex] < limit {
+				limit = labelOffsets[nextLabelIndex]
+			}
+			if bank == 0 && offset < 0x100 && limit > 0x100 {
+				limit = 0x100
+			}
+
+			address := rom.GetAddress(offset)
+			runLength := 1
+			for offset+runLength < limit && output[offset+runLength] == output[offset] {
+				runLength++
+			}
+
+			if runLength >= disassemblerMinimumRunLength {
+				if output[offset] == 0 {
+					Disassembler_WriteLine(lines, fmt.Sprintf("ds %d", runLength), bank, address, nil)
+				} else {
+					Disassembler_WriteLine(lines, fmt.Sprintf("ds %d, 0x%02X", runLength, output[offset]), bank, address, nil)
+				}
+				offset += runLength
+				continue
+			}
+
+			codeLimit := offset
+			for codeLimit < limit && !isData[codeLimit] {
+				codeLimit++
+			}
+
+			text, size := Disassembler_DecodeInstruction(output[offset:codeLimit], address, targetName)
+			if size == 0 {
+				// data, or something that isn't an instruction
+				size = 1
+				for isData[offset] && size < disassemblerBytesPerLine && offset+size < limit && isData[offset+size] {
+					size++
+				}
+				byteStrings := []string{}
+				for _, b := range output[offset : offset+size] {
+					byteStrings = append(byteStrings, fmt.Sprintf("0x%02X", b))
+				}
+				text = "db " + strings.Join(byteStrings, ", ")
+			}
+
+			Disassembler_WriteLine(lines, text, bank, address, output[offset:offset+size])
+			offset += size
+		}
+	}
+
+	return lines.Flush()
+}
+
+// Disassembler_WriteLine writes one line of the disassembly, with its location and bytes in a comment.
+func Disassembler_WriteLine(writer io.Writer, text string, bank int, address int, data []byte) {
+	byteStrings := []string{}
+	for _, b := range data {
+		byteStrings = append(byteStrings, fmt.Sprintf("%02X", b))
+	}
+	comment := strings.TrimSpace(fmt.Sprintf("%02X:%04X  %s", bank, address, strings.Join(byteStrings, " ")))
+	fmt.Fprintf(writer, "\t%-24s ; %s\n", text, comment)
+}
+
+// Disassembler_PlaceLabels works out where the given labels go in the output, and how they should be written.
+// Local labels are written in their short form if they come after the global label they belong to, otherwise they're left in a comment.
+// It returns the offsets that have labels in order, the lines to write at each of them, and the name to use for each offset in operands.
+func Disassembler_PlaceLabels(labels map[string]rom.Label, outputSize int) ([]int, map[int][]string, map[int]string) {
+	type placedLabel struct {
+		name   string
+		offset int
+	}
+	placed := []placedLabel{}
+	for name, label := range labels {
+		if label.Address >= 2*rom.BankSize {
+			// it's in RAM or something
+			continue
+		}
+		offset := rom.GetOffset(label.Bank, label.Address)
+		if offset >= outputSize {
+			continue
+		}
+		placed = append(placed, placedLabel{name, offset})
+	}
+	sort.Slice(placed, func(i, j int) bool {
+		if placed[i].offset != placed[j].offset {
+			return placed[i].offset < placed[j].offset
+		}
+		// global labels go before the local ones that might belong to them
+		iIsLocal, jIsLocal := strings.Contains(placed[i].name, "."), strings.Contains(placed[j].name, ".")
+		if iIsLocal != jIsLocal {
+			return jIsLocal
+		}
+		return placed[i].name < placed[j].name
+	})
+
+	offsets := []int{}
+	lines := map[int][]string{}
+	names := map[int]string{}
+	scope := ""
+	for _, label := range placed {
+		line := label.name + ":"
+		usable := true
+		if label.offset >= 0x100 && label.offset < 0x150 {
+			// it's in the header, which isn't disassembled
+			usable = false
+		} else if dot := strings.Index(label.name, "."); dot == -1 {
+			scope = label.name
+		} else if label.name[:dot] == scope {
+			line = label.name[dot:] + ":"
+		} else {
+			line = "; " + line
+			usable = false
+		}
+
+		if _, exists := lines[label.offset]; !exists {
+			offsets = append(offsets, label.offset)
+		}
+		lines[label.offset] = append(lines[label.offset], line)
+		if _, exists := names[label.offset]; usable && !exists {
+			names[label.offset] = label.name
+		}
+	}
+	return offsets, lines, names
+}
+
+// Disassembler_ReadSymbolFile reads labels from a symbol file, with a "bank:address name" line for each label.
+func Disassembler_ReadSymbolFile(reader io.Reader) (map[string]rom.Label, error) {
+	labels := map[string]rom.Label{}
+	err := Disassembler_ReadLines(reader, func(fields []string, lineNumber int) error {
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: expected bank:address and name", lineNumber)
+		}
+		label, err := Disassembler_ParseLocation(fields[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		labels[fields[1]] = label
+		return nil
+	})
+	return labels, err
+}
+
+// Disassembler_ReadHintFile reads hints from a file with a "code bank:start bank:end" or "data bank:start bank:end" line for each range.
+func Disassembler_ReadHintFile(reader io.Reader) ([]Hint, error) {
+	hints := []Hint{}
+	err := Disassembler_ReadLines(reader, func(fields []string, lineNumber int) error {
+		if len(fields) != 3 || (fields[0] != "code" && fields[0] != "data") {
+			return fmt.Errorf("line %d: expected code or data, and the bank:address of the start and end", lineNumber)
+		}
+		start, err := Disassembler_ParseLocation(fields[1])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		end, err := Disassembler_ParseLocation(fields[2])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		if start.Bank != end.Bank || start.Address > end.Address {
+			return fmt.Errorf("line %d: end of range has to be after the start, in the same bank", lineNumber)
+		}
+		hints = append(hints, Hint{fields[0] == "data", start.Bank, start.Address, end.Address})
+		return nil
+	})
+	return hints, err
+}
+
+// Disassembler_ReadLines calls handleLine with the fields of every line in the reader, skipping empty lines and comments.
+func Disassembler_ReadLines(reader io.Reader, handleLine func(fields []string, lineNumber int) error) error {
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if comment := strings.Index(line, ";"); comment != -1 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := handleLine(fields, lineNumber); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Disassembler_ParseLocation parses a location in the "bank:address" format, in hexadecimal.
+func Disassembler_ParseLocation(location string) (rom.Label, error) {
+	parts := strings.Split(location, ":")
+	if len(parts) != 2 {
+		return rom.Label{}, fmt.Errorf("expected bank:address, got '%s'", location)
+	}
+	bank, bankErr := strconv.ParseUint(parts[0], 16, 16)
+	address, addressErr := strconv.ParseUint(parts[1], 16, 16)
+	if bankErr != nil || addressErr != nil {
+		return rom.Label{}, fmt.Errorf("expected bank:address, got '%s'", location)
+	}
+	return rom.Label{Bank: int(bank), Address: int(address)}, nil
+}
@@ -0,0 +1,157 @@
+package assembler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func TestDecodeInstruction(t *testing.T) {
+	tests := map[string][]byte{
+		"nop":             {0x00},
+		"ld [0xC000], sp": {0x08, 0x00, 0xC0},
+		"stop":            {0x10, 0x00},
+		"jr 0x0152":       {0x18, 0x00},
+		"jr nz, 0x014E":   {0x20, 0xFC},
+		"ld de, 0x1234":   {0x11, 0x34, 0x12},
+		"add hl, sp":      {0x39},
+		"ld [hl+], a":     {0x22},
+		"ld a, [hl-]":     {0x3A},
+		"inc bc":          {0x03},
+		"dec [hl]":        {0x35},
+		"ld [hl], 0x05":   {0x36, 0x05},
+		"ccf":             {0x3F},
+		"ld b, [hl]":      {0x46},
+		"halt":            {0x76},
+		"adc a, e":        {0x8B},
+		"xor a":           {0xAF},
+		"ret c":           {0xD8},
+		"ldh [0xFF40], a": {0xE0, 0x40},
+		"add sp, -2":      {0xE8, 0xFE},
+		"ldh a, [0xFF44]": {0xF0, 0x44},
+		"ld hl, sp+3":     {0xF8, 0x03},
+		"pop af":          {0xF1},
+		"reti":            {0xD9},
+		"jp hl":           {0xE9},
+		"jp z, 0x0150":    {0xCA, 0x50, 0x01},
+		"ld [c], a":       {0xE2},
+		"ld a, [0xD000]":  {0xFA, 0x00, 0xD0},
+		"jp 0x0150":       {0xC3, 0x50, 0x01},
+		"ei":              {0xFB},
+		"call nc, 0x4000": {0xD4, 0x00, 0x40},
+		"push hl":         {0xE5},
+		"call 0x0150":     {0xCD, 0x50, 0x01},
+		"cp 0x90":         {0xFE, 0x90},
+		"rst 0x38":        {0xFF},
+		"swap [hl]":       {0xCB, 0x36},
+		"srl a":           {0xCB, 0x3F},
+		"bit 7, h":        {0xCB, 0x7C},
+		"res 0, b":        {0xCB, 0x80},
+		"set 3, [hl]":     {0xCB, 0xDE},
+	}
+	targetName := func(target int) string {
+		return fmt.Sprintf("0x%04X", target)
+	}
+	for expected, data := range tests {
+		text, size := Disassembler_DecodeInstruction(data, 0x150, targetName)
+		if text != expected {
+			t.Errorf("% X was disassembled as '%s', should have been '%s'", data, text, expected)
+		}
+		if size != len(data) {
+			t.Errorf("% X had a size of %d", data, size)
+		}
+	}
+
+	// the bytes after the instruction don't matter
+	if text, size := Disassembler_DecodeInstruction([]byte{0x3E, 0x01, 0xFF}, 0x150, targetName); text != "ld a, 0x01" || size != 2 {
+		t.Errorf("3E 01 FF was disassembled as '%s' with a size of %d", text, size)
+	}
+
+	// things that aren't instructions, or that are cut off
+	for _, data := range [][]byte{{0xD3}, {0xDD}, {0xEC}, {0x10, 0x01}, {0xC3, 0x50}, {0xCB}} {
+		if text, size := Disassembler_DecodeInstruction(data, 0x150, targetName); size != 0 {
+			t.Errorf("% X was disassembled as '%s', should have been invalid", data, text)
+		}
+	}
+}
+
+func TestDisassembleRoundTrip(t *testing.T) {
+	info := rom.Info{Name: "TEST", MBC: "MBC1", ROMSize: 64}
+
+	// every opcode, with some operands after it, and some labels and data
+	code := []string{}
+	for i := 0; i < 0x100; i++ {
+		if i != 0xCB {
+			code = append(code, fmt.Sprintf("\tdb 0x%02X, 0x%02X, 0x12", i, i^0x55))
+		}
+		code = append(code, fmt.Sprintf("\tdb 0xCB, 0x%02X", i))
+	}
+	source := "start:\n\tld b, 3\n.loop:\n\tdec b\n\tjr nz, .loop\n\tcall far\n" + strings.Join(code, "\n") + "\n" +
+		"table:\n\tdb 0x10, 0x01, 0xC3\n\tds 32, 0xFF\n\tjp start\n.bank 3\nfar:\n\tret\n"
+
+	result, err := Assemble(fstest.MapFS{"main.s": &fstest.MapFile{Data: []byte(source)}}, "main.s", Options{Info: &info})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := result.Labels["table"]
+	options := DisassemblyOptions{
+		Labels: result.Labels,
+		Hints:  []Hint{{true, 0, table.Address, table.Address + 2}},
+	}
+	disassembly := bytes.Buffer{}
+	if err := Disassembler_Write(&disassembly, result.ROM, options); err != nil {
+		t.Fatal(err)
+	}
+	// the call to far stays a number, since code in bank 0 can't know which bank it's for
+	for _, expected := range []string{"start:\n", ".loop:\n", "\tjr nz, start.loop ", "\tcall 0x4000 ", "table:\n\tdb 0x10, 0x01, 0xC3 ", "\tds 32, 0xFF ", ".bank 3\nfar:\n\tret "} {
+		if !strings.Contains(disassembly.String(), expected) {
+			t.Errorf("Disassembly didn't contain '%s'", expected)
+		}
+	}
+
+	reassembled, err := Assemble(fstest.MapFS{"main.s": &fstest.MapFile{Data: disassembly.Bytes()}}, "main.s", Options{Info: &info})
+	if err != nil {
+		t.Fatalf("Reassembling failed: %s\n%s", err, disassembly.String())
+	}
+	if !bytes.Equal(reassembled.ROM, result.ROM) {
+		for i := range result.ROM {
+			if reassembled.ROM[i] != result.ROM[i] {
+				t.Fatalf("Reassembled ROM was different, starting at offset 0x%X", i)
+			}
+		}
+	}
+}
+
+func TestReadSymbolAndHintFiles(t *testing.T) {
+	labels, err := Disassembler_ReadSymbolFile(strings.NewReader("; generated by gbasm\n00:0150 start\n02:4abc far\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 2 || labels["start"] != (rom.Label{Bank: 0, Address: 0x150}) || labels["far"] != (rom.Label{Bank: 2, Address: 0x4ABC}) {
+		t.Errorf("Labels were %+v", labels)
+	}
+
+	hints, err := Disassembler_ReadHintFile(strings.NewReader("data 01:4000 01:40FF ; a table\ncode 01:4010 01:4010\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hints) != 2 || hints[0] != (Hint{true, 1, 0x4000, 0x40FF}) || hints[1] != (Hint{false, 1, 0x4010, 0x4010}) {
+		t.Errorf("Hints were %+v", hints)
+	}
+
+	for _, bad := range []string{"00:0150", "0150 start", "zz:0150 start"} {
+		if _, err := Disassembler_ReadSymbolFile(strings.NewReader(bad)); err == nil {
+			t.Errorf("Reading symbol file '%s' should have failed", bad)
+		}
+	}
+	for _, bad := range []string{"text 00:0000 00:0010", "data 00:0010 00:0000", "data 00:0000 01:4000", "data 00:0000"} {
+		if _, err := Disassembler_ReadHintFile(strings.NewReader(bad)); err == nil {
+			t.Errorf("Reading hint file '%s' should have failed", bad)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+// a linkerSpan is a part of memory that's already been taken by something
+type linkerSpan struct {
+	start   int
+	end     int
+	name    string
+	section *object.Section // nil if it isn't a section, like the header
+}
+
+// Linker_UsedSpans contains the spans that have been taken so far, keyed by memory area.
+// All of ROM is one area, using offsets into the output, while RAM uses addresses.
+var Linker_UsedSpans map[string][]linkerSpan
+
+// Linker_SectionObjects contains the object that each section came from, to find the source of its output.
+var Linker_SectionObjects map[*object.Section]*object.Object
+
+// Linker_Constants contains the constants from every object that was linked.
+var Linker_Constants map[string]int
+
+// Linker_Link places the sections of the given objects into the ROM and assembles their relocations.
+func Linker_Link(objects []*object.Object) {
+	rom.Current.Relocatable = false
+	rom.Current.UnpointedDefinitions = []string{}
+	rom.Current.Labels = map[string]rom.Label{}
+	rom.Current.SectionSizes = map[string]int{}
+	Linker_Constants = map[string]int{}
+
+	Linker_PlaceSections(objects)
+	if diagnostics.HasErrors() {
+		// some sections don't have a place, so nothing else can be worked out
+		return
+	}
+
+	// now that everything has a place, find out where the labels point to
+	symbolsByName := map[string]object.Symbol{}
+	for _, o := range objects {
+		for _, section := range o.Sections {
+			rom.Current.SectionSizes[section.Name] = section.Size
+
+			for _, symbol := range section.Symbols {
+				existingSymbol, exists := symbolsByName[symbol.Name]
+				if exists {
+					diagnostics.Errorf(symbol.File, symbol.Line, "Label '%s' is already declared at %s:%d", symbol.Name, existingSymbol.File, existingSymbol.Line)
+					continue
+				}
+				symbolsByName[symbol.Name] = symbol
+
+				rom.Current.Labels[symbol.Name] = Linker_GetLocation(section, symbol.Offset)
+			}
+		}
+	}
+
+	// jump to the entry point and vectors from info.toml
+	if rom.Current.Info.Entry != "" {
+		Linker_WriteJump(0x101, rom.Current.Info.Entry, "Entry")
+	}
+	for _, name := range Linker_GetVectorNames() {
+		Linker_WriteJump(rom.Vectors[strings.ToLower(name)], rom.Current.Info.Vectors[name], "Vector '"+name+"'")
+	}
+
+	// copy everything over and assemble the relocations, with the constants from each object
+	rom.Current.UsedByteCount = 0
+	rom.Current.UsedRAMByteCounts = map[string]int{}
+	for _, o := range objects {
+		rom.Current.Definitions = map[string]int{}
+		rom.Current.DeclaredConstants = []string{} // every label is known by now, so every constant is too
+		for name, label := range rom.Current.Labels {
+			rom.Current.Definitions[name] = label.Address
+		}
+		for name, value := range o.Constants {
+			if symbol, isLabel := symbolsByName[name]; isLabel {
+				diagnostics.Errorf(symbol.File, symbol.Line, "Label '%s' has the same name as a constant", name)
+			}
+			rom.Current.Definitions[name] = value
+			rom.Current.DeclaredConstants = append(rom.Current.DeclaredConstants, name)
+
+			// objects that include the same file have the same constants, which is fine as long as they agree
+			if existingValue, exists := Linker_Constants[name]; exists && existingValue != value {
+				diagnostics.Errorf("", 0, "Constant '%s' is %d in one object and %d in another", name, existingValue, value)
+			}
+			Linker_Constants[name] = value
+		}
+
+		for _, section := range o.Sections {
+			if object.SectionTypes[section.Type].IsRAM {
+				rom.Current.UsedRAMByteCounts[section.Type] += section.Size
+				continue
+			}
+
+			sectionOffset := rom.GetOffset(section.Bank, section.Address)
+			copy(rom.Current.Output[sectionOffset:], section.Data)
+			rom.Current.UsedByteCount += section.Size
+
+			for _, relocation := range section.Relocations {
+				diagnostics.Try(relocation.File, relocation.Line, 0, func() {
+					offset := sectionOffset + relocation.Offset
+					instruction := Assembler_ProcessOperands(Instruction{relocation.Mnemonic, relocation.Operands}, 1, relocation.File, relocation.Line)
+					output := OpCodes_GetOutput(instruction, rom.GetAddress(offset), 1, relocation.File, relocation.Line)
+					if len(output) != relocation.Size {
+						diagnostics.Fatalf(relocation.File, relocation.Line, "Instruction '%s' changed size from %d to %d bytes while linking", relocation.Mnemonic, relocation.Size, len(output))
+					}
+					copy(rom.Current.Output[offset:], output)
+				})
+			}
+		}
+
+		for _, assertion := range o.Assertions {
+			diagnostics.Try(assertion.File, assertion.Line, 0, func() {
+				Assembler_CheckAssertion(assertion, 1)
+			})
+		}
+	}
+}
+
+// Linker_GetVectorNames returns the names of the vectors in info.toml, in order.
+func Linker_GetVectorNames() []string {
+	names := []string{}
+	for name := range rom.Current.Info.Vectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Linker_WriteJump puts a JP to the given label at the given offset in the ROM.
+// The description says where the label came from, for errors.
+func Linker_WriteJump(offset int, labelName string, description string) {
+	label, exists := rom.Current.Labels[labelName]
+	if !exists {
+		diagnostics.Errorf("info.toml", 0, "%s label '%s' doesn't exist", description, labelName)
+		return
+	}
+	if label.Address >= rom.BankSize {
+		// an interrupt could happen while any bank is switched in, so it has to be in the one that's always there
+		diagnostics.Errorf("info.toml", 0, "%s label '%s' has to be in ROM0", description, labelName)
+		return
+	}
+	rom.Current.Output[offset] = 0xC3 // JP
+	rom.Current.Output[offset+1] = byte(label.Address & 0xFF)
+	rom.Current.Output[offset+2] = byte(label.Address >> 8)
+}
+
+// Linker_GetLocation returns the bank and address of the given offset into a placed section.
+func Linker_GetLocation(section *object.Section, offset int) rom.Label {
+	if object.SectionTypes[section.Type].IsRAM {
+		return rom.Label{Bank: section.Bank, Address: section.Address + offset}
+	}
+	// a ROM0 section can go on into bank 1
+	romOffset := rom.GetOffset(section.Bank, section.Address) + offset
+	return rom.Label{Bank: rom.GetBank(romOffset), Address: rom.GetAddress(romOffset)}
+}
+
+// Linker_PlaceSections picks a bank and address for every section, making sure that nothing overlaps.
+func Linker_PlaceSections(objects []*object.Object) {
+	Linker_UsedSpans = map[string][]linkerSpan{}
+	Linker_SectionObjects = map[*object.Section]*object.Object{}
+
+	// the header is always there, and so are the jumps to any vectors from info.toml
+	Linker_UseSpan("ROM", 0x100, 0x150, "the cartridge header", nil)
+	for _, name := range Linker_GetVectorNames() {
+		address := rom.Vectors[strings.ToLower(name)]
+		Linker_UseSpan("ROM", address, address+3, "the "+name+" vector from info.toml", nil)
+	}
+
+	sectionsByName := map[string]*object.Section{}
+	fixedSections := []*object.Section{}
+	floatingSections := []*object.Section{}
+	for _, o := range objects {
+		for _, section := range o.Sections {
+			Linker_SectionObjects[section] = o
+
+			existingSection, exists := sectionsByName[section.Name]
+			if exists {
+				diagnostics.Errorf(section.File, section.Line, "Section '%s' is already declared at %s:%d", section.Name, existingSection.File, existingSection.Line)
+				continue
+			}
+			sectionsByName[section.Name] = section
+
+			if section.Bank != object.Unspecified && section.Address != object.Unspecified {
+				fixedSections = append(fixedSections, section)
+			} else {
+				floatingSections = append(floatingSections, section)
+			}
+		}
+	}
+
+	// place the fixed sections first, so that the floating ones can fill in around them
+	for _, section := range fixedSections {
+		diagnostics.Try(section.File, section.Line, 0, func() {
+			Linker_CheckBank(section, section.Bank)
+			key, start, end := Linker_GetSpan(section, section.Bank, section.Address)
+			Linker_CheckSpanIsFree(section, key, start, end)
+			Linker_UseSpan(key, start, end, Linker_DescribeSection(section), section)
+		})
+	}
+
+	// then the floating ones, biggest first since those are the hardest to fit
+	sort.SliceStable(floatingSections, func(i, j int) bool {
+		return floatingSections[i].Size > floatingSections[j].Size
+	})
+	for _, section := range floatingSections {
+		diagnostics.Try(section.File, section.Line, 0, func() {
+			if !Linker_PlaceFloatingSection(section) {
+				diagnostics.Errorf(section.File, section.Line, "Not enough space for %s (%d bytes)", Linker_DescribeSection(section), section.Size)
+			}
+		})
+	}
+}
+
+// Linker_PlaceFloatingSection tries to find a place for a section that doesn't have a fixed bank or address.
+func Linker_PlaceFloatingSection(section *object.Section) bool {
+	typeInfo := object.SectionTypes[section.Type]
+
+	banks := []int{section.Bank}
+	if section.Bank == object.Unspecified {
+		Linker_CheckHasRAM(section)
+		bankCount := Linker_GetBankCount(section.Type)
+		if section.Type == "WRAMX" && rom.GetCGBMode(rom.Current.Info) == rom.CGBCompatible {
+			// the original Gameboy only has bank 1, so games that run on both have to pick the other banks on purpose
+			bankCount = 2
+		}
+		banks = []int{}
+		for bank := typeInfo.FirstBank; bank < bankCount; bank++ {
+			banks = append(banks, bank)
+		}
+	} else {
+		Linker_CheckBank(section, section.Bank)
+	}
+
+	for _, bank := range banks {
+		if section.Address != object.Unspecified {
+			key, start, end := Linker_GetSpan(section, bank, section.Address)
+			if end <= Linker_GetAreaEnd(section, bank) && Linker_FindOverlap(key, start, end) == nil {
+				section.Bank = bank
+				Linker_UseSpan(key, start, end, Linker_DescribeSection(section), section)
+				return true
+			}
+			continue
+		}
+
+		key, areaStart, _ := Linker_GetSpan(section, bank, typeInfo.Start)
+		start, found := Linker_FindFreeSpan(key, areaStart, Linker_GetAreaEnd(section, bank), section.Size, section.Align)
+		if found {
+			section.Bank = bank
+			section.Address = typeInfo.Start + (start - areaStart)
+			Linker_UseSpan(key, start, start+section.Size, Linker_DescribeSection(section), section)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Linker_GetBankCount returns how many banks there are for the given section type, including bank 0 for ROMX and WRAMX.
+func Linker_GetBankCount(sectionType string) int {
+	switch sectionType {
+	case "ROMX":
+		return len(rom.Current.Output) / rom.BankSize
+	case "WRAMX":
+		if rom.GetCGBMode(rom.Current.Info) == rom.CGBNone {
+			// only the Gameboy Color can switch WRAM banks
+			return 2
+		}
+		return 8
+	case "SRAM":
+		return rom.Current.Info.RAMSize / 8
+	}
+	return 1
+}
+
+// Linker_CheckBank makes sure that the given bank exists for the section.
+func Linker_CheckBank(section *object.Section, bank int) {
+	typeInfo := object.SectionTypes[section.Type]
+	Linker_CheckHasRAM(section)
+	if typeInfo.IsBanked && (bank < typeInfo.FirstBank || bank >= Linker_GetBankCount(section.Type)) {
+		diagnostics.Fatalf(section.File, section.Line, "%s is in bank %d, but there are only %d banks", Linker_DescribeSection(section), bank, Linker_GetBankCount(section.Type))
+	}
+}
+
+// Linker_CheckHasRAM makes sure that there's cartridge RAM, if the section needs it.
+func Linker_CheckHasRAM(section *object.Section) {
+	if section.Type == "SRAM" && Linker_GetBankCount(section.Type) == 0 {
+		diagnostics.Fatalf(section.File, section.Line, "%s needs cartridge RAM, but RAMSize in info.toml is 0", Linker_DescribeSection(section))
+	}
+}
+
+// Linker_GetSpan returns the memory area, start, and end that the section would take up at the given bank and address.
+func Linker_GetSpan(section *object.Section, bank int, address int) (string, int, int) {
+	typeInfo := object.SectionTypes[section.Type]
+	if typeInfo.IsRAM {
+		key := section.Type
+		if typeInfo.IsBanked {
+			key += ":" + strconv.Itoa(bank)
+		}
+		return key, address, address + section.Size
+	}
+	start := rom.GetOffset(bank, address)
+	return "ROM", start, start + section.Size
+}
+
+// Linker_GetAreaEnd returns where the area that the section is in ends, in the same units as Linker_GetSpan.
+func Linker_GetAreaEnd(section *object.Section, bank int) int {
+	typeInfo := object.SectionTypes[section.Type]
+	if typeInfo.IsRAM {
+		return typeInfo.End
+	}
+	if section.Type == "ROM0" && section.Address != object.Unspecified {
+		// fixed sections can go on into bank 1, the CPU sees those as one continuous area
+		return 2 * rom.BankSize
+	}
+	return rom.GetOffset(bank, typeInfo.Start) + (typeInfo.End - typeInfo.Start)
+}
+
+// Linker_CheckSpanIsFree makes sure that a fixed section fits where it was asked to go.
+func Linker_CheckSpanIsFree(section *object.Section, key string, start int, end int) {
+	if end > Linker_GetAreaEnd(section, section.Bank) || (key == "ROM" && end > len(rom.Current.Output)) {
+		diagnostics.Fatalf(section.File, section.Line, "%s goes past the end of %s", Linker_DescribeSection(section), section.Type)
+	}
+	overlap := Linker_FindOverlap(key, start, end)
+	if overlap == nil {
+		return
+	}
+
+	// find the lines that both claim the first byte of the overlap
+	position := start
+	if overlap.start > position {
+		position = overlap.start
+	}
+	file, line := section.File, section.Line
+	if listingLine, found := Linker_FindSourceLine(section, position-start); found {
+		file, line = listingLine.File, listingLine.Line
+	}
+	other := overlap.name
+	if overlap.section != nil {
+		if listingLine, found := Linker_FindSourceLine(overlap.section, position-overlap.start); found {
+			other = fmt.Sprintf("%s:%d in %s", listingLine.File, listingLine.Line, overlap.name)
+		}
+	}
+	location := Linker_GetLocation(section, position-start)
+	diagnostics.Fatalf(file, line, "Output at %02X:%04X overlaps %s", location.Bank, location.Address, other)
+}
+
+// Linker_FindSourceLine returns the line of source code that put something at the given offset in the section.
+func Linker_FindSourceLine(section *object.Section, offset int) (object.ListingLine, bool) {
+	o, found := Linker_SectionObjects[section]
+	if !found {
+		return object.ListingLine{}, false
+	}
+	for _, listingLine := range o.Listing {
+		if listingLine.Section == section.Name && listingLine.Offset <= offset && offset < listingLine.Offset+listingLine.Size {
+			return listingLine, true
+		}
+	}
+	return object.ListingLine{}, false
+}
+
+// Linker_FindOverlap returns a used span that overlaps the given one, or nil if there isn't one.
+func Linker_FindOverlap(key string, start int, end int) *linkerSpan {
+	if start == end {
+		return nil
+	}
+	for i, span := range Linker_UsedSpans[key] {
+		if span.start < end && start < span.end {
+			return &Linker_UsedSpans[key][i]
+		}
+	}
+	return nil
+}
+
+// Linker_FindFreeSpan finds the first free space of the given size between from and to.
+func Linker_FindFreeSpan(key string, from int, to int, size int, alignment int) (int, bool) {
+	candidate := Linker_AlignUp(from, alignment)
+	for _, span := range Linker_UsedSpans[key] {
+		if span.end <= candidate || span.start == span.end {
+			continue
+		}
+		if span.start >= candidate+size {
+			break
+		}
+		candidate = Linker_AlignUp(span.end, alignment)
+	}
+	if candidate+size > to {
+		return 0, false
+	}
+	return candidate, true
+}
+
+// Linker_AlignUp returns the first multiple of the alignment that's at least the given position.
+func Linker_AlignUp(position int, alignment int) int {
+	if alignment <= 1 {
+		return position
+	}
+	return (position + alignment - 1) / alignment * alignment
+}
+
+// Linker_UseSpan marks the given span as used.
+func Linker_UseSpan(key string, start int, end int, name string, section *object.Section) {
+	Linker_UsedSpans[key] = append(Linker_UsedSpans[key], linkerSpan{start, end, name, section})
+	sort.Slice(Linker_UsedSpans[key], func(i, j int) bool {
+		return Linker_UsedSpans[key][i].start < Linker_UsedSpans[key][j].start
+	})
+}
+
+// Linker_DescribeSection returns a description of the section for error messages.
+func Linker_DescribeSection(section *object.Section) string {
+	location := section.File + ":" + strconv.Itoa(section.Line)
+	if section.Line == 0 {
+		// it's the default section
+		return "section '" + section.Name + "'"
+	} else if section.Name == location {
+		// it's from a .org or .bank
+		return "section at " + location
+	}
+	return "section '" + section.Name + "' (" + location + ")"
+}
@@ -0,0 +1,145 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func TestPlaceSections(t *testing.T) {
+	rom.Current.Output = make([]byte, 4*rom.BankSize)
+
+	fixed := &object.Section{Name: "fixed", Type: "ROM0", Bank: 0, Address: 0x150, Size: 0x100}
+	floating := &object.Section{Name: "floating", Type: "ROM0", Bank: 0, Address: object.Unspecified, Size: 0x200}
+	fixedBank := &object.Section{Name: "fixedBank", Type: "ROMX", Bank: 2, Address: object.Unspecified, Size: 0x10}
+	floatingBank := &object.Section{Name: "floatingBank", Type: "ROMX", Bank: object.Unspecified, Address: object.Unspecified, Size: 0x3FFF}
+	ram := &object.Section{Name: "ram", Type: "WRAM0", Bank: 0, Address: object.Unspecified, Size: 0x20}
+
+	testObject := object.New()
+	testObject.Sections = []*object.Section{fixed, floating, fixedBank, floatingBank, ram}
+	Linker_PlaceSections([]*object.Object{testObject})
+
+	expected := []struct {
+		section *object.Section
+		bank    int
+		address int
+	}{
+		{fixed, 0, 0x150},
+		{floating, 0, 0x250}, // doesn't fit before the header
+		{fixedBank, 2, 0x4000},
+		{floatingBank, 1, 0x4000},
+		{ram, 0, 0xC000},
+	}
+	for _, test := range expected {
+		if test.section.Bank != test.bank || test.section.Address != test.address {
+			t.Errorf("Section '%s' was placed at %d:0x%X, should have been %d:0x%X", test.section.Name, test.section.Bank, test.section.Address, test.bank, test.address)
+		}
+	}
+}
+
+func TestPlaceRAMSections(t *testing.T) {
+	rom.Current.Output = make([]byte, 2*rom.BankSize)
+	rom.Current.Info = rom.Info{RAMSize: 32}
+	defer func() { rom.Current.Info = rom.Info{} }()
+	diagnostics.Reset()
+
+	wramFirst := &object.Section{Name: "wramFirst", Type: "WRAMX", Bank: object.Unspecified, Address: object.Unspecified, Size: 0xC00}
+	wramSecond := &object.Section{Name: "wramSecond", Type: "WRAMX", Bank: object.Unspecified, Address: object.Unspecified, Size: 0x800}
+	wramFixed := &object.Section{Name: "wramFixed", Type: "WRAMX", Bank: 3, Address: 0xD100, Size: 0x10}
+	sram := &object.Section{Name: "sram", Type: "SRAM", Bank: object.Unspecified, Address: object.Unspecified, Size: 0x2000}
+	sramSecond := &object.Section{Name: "sramSecond", Type: "SRAM", Bank: object.Unspecified, Address: object.Unspecified, Size: 0x10}
+	hram := &object.Section{Name: "hram", Type: "HRAM", Bank: 0, Address: object.Unspecified, Size: 0x7F}
+
+	testObject := object.New()
+	testObject.Sections = []*object.Section{wramFirst, wramSecond, wramFixed, sram, sramSecond, hram}
+	Linker_PlaceSections([]*object.Object{testObject})
+	if diagnostics.HasErrors() {
+		t.Fatalf("Placing sections failed: %v", diagnostics.Current)
+	}
+
+	expected := []struct {
+		section *object.Section
+		bank    int
+		address int
+	}{
+		{wramFirst, 1, 0xD000},
+		{wramSecond, 2, 0xD000}, // doesn't fit after the first one
+		{wramFixed, 3, 0xD100},
+		{sram, 0, 0xA000},
+		{sramSecond, 1, 0xA000},
+		{hram, 0, 0xFF80},
+	}
+	for _, test := range expected {
+		if test.section.Bank != test.bank || test.section.Address != test.address {
+			t.Errorf("Section '%s' was placed at %d:0x%X, should have been %d:0x%X", test.section.Name, test.section.Bank, test.section.Address, test.bank, test.address)
+		}
+	}
+
+	// games that also run on the original Gameboy only get other WRAM banks when they ask for them
+	diagnostics.Reset()
+	rom.Current.Info = rom.Info{SupportsDMG: true}
+	cgbFixed := &object.Section{Name: "cgbFixed", Type: "WRAMX", Bank: 5, Address: object.Unspecified, Size: 0x10}
+	dmgFirst := &object.Section{Name: "dmgFirst", Type: "WRAMX", Bank: object.Unspecified, Address: object.Unspecified, Size: 0x1000}
+	dmgSecond := &object.Section{Name: "dmgSecond", Type: "WRAMX", Bank: object.Unspecified, Address: object.Unspecified, Size: 1}
+	testObject.Sections = []*object.Section{cgbFixed, dmgFirst, dmgSecond}
+	Linker_PlaceSections([]*object.Object{testObject})
+	// the only error should be that dmgSecond doesn't fit, since bank 1 is full
+	if cgbFixed.Bank != 5 || dmgFirst.Bank != 1 || len(diagnostics.Current) != 1 {
+		t.Errorf("Sections were placed in banks %d and %d, with diagnostics %v", cgbFixed.Bank, dmgFirst.Bank, diagnostics.Current)
+	}
+
+	// things that don't fit
+	rom.Current.Info = rom.Info{CGB: "NONE"}
+	tests := []*object.Section{
+		&object.Section{Name: "noRAM", Type: "SRAM", Bank: object.Unspecified, Address: object.Unspecified, Size: 1},
+		&object.Section{Name: "dmgBank", Type: "WRAMX", Bank: 2, Address: 0xD000, Size: 1},
+		&object.Section{Name: "bigHRAM", Type: "HRAM", Bank: 0, Address: object.Unspecified, Size: 0x80},
+	}
+	for _, section := range tests {
+		diagnostics.Reset()
+		testObject.Sections = []*object.Section{section}
+		Linker_PlaceSections([]*object.Object{testObject})
+		if !diagnostics.HasErrors() {
+			t.Errorf("Placing section '%s' should have failed", section.Name)
+		}
+	}
+	diagnostics.Reset()
+}
+
+func TestOverlapLocations(t *testing.T) {
+	rom.Current.Output = make([]byte, 2*rom.BankSize)
+	diagnostics.Reset()
+	defer diagnostics.Reset()
+
+	first := object.New()
+	first.Sections = []*object.Section{&object.Section{Name: "first", Type: "ROM0", Bank: 0, Address: 0x150, Size: 4, File: "first.s", Line: 1}}
+	first.Listing = []object.ListingLine{
+		{Section: "first", Offset: 0, Size: 2, File: "first.s", Line: 2},
+		{Section: "first", Offset: 2, Size: 2, File: "first.s", Line: 3},
+	}
+	second := object.New()
+	second.Sections = []*object.Section{
+		&object.Section{Name: "second", Type: "ROM0", Bank: 0, Address: 0x152, Size: 4, File: "second.s", Line: 1},
+		&object.Section{Name: "header", Type: "ROM0", Bank: 0, Address: 0xFF, Size: 2, File: "second.s", Line: 7},
+	}
+	second.Listing = []object.ListingLine{
+		{Section: "second", Offset: 0, Size: 1, File: "second.s", Line: 5},
+		{Section: "header", Offset: 0, Size: 2, File: "second.s", Line: 8},
+	}
+
+	Linker_PlaceSections([]*object.Object{first, second})
+	expected := []string{
+		"second.s:5: error: Output at 00:0152 overlaps first.s:3 in section 'first' (first.s:1)",
+		"second.s:8: error: Output at 00:0100 overlaps the cartridge header",
+	}
+	if len(diagnostics.Current) != len(expected) {
+		t.Fatalf("Got diagnostics %v, should have been %v", diagnostics.Current, expected)
+	}
+	for i, diagnostic := range diagnostics.Current {
+		if diagnostic.String() != expected[i] {
+			t.Errorf("Diagnostic was '%s', should have been '%s'", diagnostic.String(), expected[i])
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+// how many bytes of output go on each line of the listing
+const listingBytesPerLine = 4
+
+// Listing_Write writes a listing of the given linked objects, with the address and output of every line next to its source.
+// The output is the ROM that the objects were linked into.
+func Listing_Write(writer io.Writer, output []byte, objects []*object.Object) error {
+	for _, o := range objects {
+		for _, listingLine := range o.Listing {
+			location := fmt.Sprintf("%s:%d", listingLine.File, listingLine.Line)
+
+			section := o.FindSection(listingLine.Section)
+			if section == nil {
+				// nothing to show other than the source
+				if err := Listing_WriteLine(writer, location, "", "", listingLine.Text); err != nil {
+					return err
+				}
+				continue
+			}
+
+			address := Linker_GetLocation(section, listingLine.Offset)
+			addressString := fmt.Sprintf("%02X:%04X", address.Bank, address.Address)
+
+			lineOutput := []byte{}
+			if !object.SectionTypes[section.Type].IsRAM {
+				start := rom.GetOffset(section.Bank, section.Address) + listingLine.Offset
+				lineOutput = output[start : start+listingLine.Size]
+			}
+
+			// long output, like strings, goes on multiple lines
+			text := listingLine.Text
+			for {
+				lineBytes := lineOutput
+				if len(lineBytes) > listingBytesPerLine {
+					lineBytes = lineBytes[:listingBytesPerLine]
+				}
+				lineOutput = lineOutput[len(lineBytes):]
+
+				byteStrings := []string{}
+				for _, b := range lineBytes {
+					byteStrings = append(byteStrings, fmt.Sprintf("%02X", b))
+				}
+
+				if err := Listing_WriteLine(writer, location, addressString, strings.Join(byteStrings, " "), text); err != nil {
+					return err
+				}
+
+				if len(lineOutput) == 0 {
+					break
+				}
+				location, addressString, text = "", "", ""
+			}
+		}
+	}
+	return nil
+}
+
+// Listing_WriteLine writes one line of the listing, with everything lined up in columns.
+func Listing_WriteLine(writer io.Writer, location string, address string, output string, text string) error {
+	line := fmt.Sprintf("%-20s %-7s  %-*s  %s", location, address, listingBytesPerLine*3-1, output, text)
+	_, err := fmt.Fprintln(writer, strings.TrimRight(line, " "))
+	return err
+}
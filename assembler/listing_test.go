@@ -0,0 +1,38 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/gbasm/object"
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func TestListing(t *testing.T) {
+	output := make([]byte, 2*rom.BankSize)
+	copy(output[0x4010:], []byte{0x3E, 0x05, 0x68, 0x65, 0x6C, 0x6C, 0x6F})
+
+	testObject := object.New()
+	testObject.Sections = []*object.Section{
+		&object.Section{Name: "code", Type: "ROMX", Bank: 1, Address: 0x4010, Size: 7},
+	}
+	testObject.Listing = []object.ListingLine{
+		{Section: "", Offset: 0, Size: 0, File: "test.s", Line: 1, Text: ".def X 5"},
+		{Section: "code", Offset: 0, Size: 2, File: "test.s", Line: 3, Text: "ld a, X"},
+		{Section: "code", Offset: 2, Size: 5, File: "test.s", Line: 4, Text: "ascii \"hello\""},
+	}
+
+	buffer := bytes.Buffer{}
+	if err := Listing_Write(&buffer, output, []*object.Object{testObject}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "test.s:1" + strings.Repeat(" ", 35) + ".def X 5\n" +
+		"test.s:3             01:4010  3E 05        ld a, X\n" +
+		"test.s:4             01:4012  68 65 6C 6C  ascii \"hello\"\n" +
+		"                              6F\n"
+	if buffer.String() != expected {
+		t.Errorf("Listing was\n%s\nshould have been\n%s", buffer.String(), expected)
+	}
+}
@@ -0,0 +1,255 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+)
+
+// Macro is a block of lines that gets inserted wherever its name is used like an instruction.
+type Macro struct {
+	Name       string
+	Parameters []string
+	Lines      []SourceLine
+	FileBase   string
+	LineNumber int
+}
+
+// Macros_Table contains the macros that have been defined so far, keyed by their name in uppercase.
+var Macros_Table map[string]*Macro
+
+// Macros_ExpansionCount is used to give every expansion a unique number, for \@.
+var Macros_ExpansionCount int
+
+// the maximum number of macros inside of macros, so that recursive ones don't go on forever
+const macroMaxDepth = 64
+
+// Macros_Reset forgets about all macros, to start a new pass through the source.
+func Macros_Reset() {
+	Macros_Table = map[string]*Macro{}
+	Macros_ExpansionCount = 0
+}
+
+// Macros_ExpandLines goes through the given lines, handling conditional blocks, macro definitions, macro uses, and repetitions.
+// Every other line is passed on to handleLine.
+func Macros_ExpandLines(lines []SourceLine, pass int, depth int, handleLine func(line SourceLine)) {
+	if depth > macroMaxDepth {
+		diagnostics.Fatalf(lines[0].FileBase, lines[0].LineNumber, "Too many macros inside of macros (is one using itself?)")
+	}
+
+	conditionalBlocks := []conditionalBlock{}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// if something goes wrong, skip to the next line, so that as many errors as possible get reported
+		diagnostics.Try(line.FileBase, line.LineNumber, line.Column, func() {
+			Macros_ExpandLine(lines, &i, &conditionalBlocks, pass, depth, handleLine)
+		})
+	}
+	Conditionals_CheckClosed(conditionalBlocks)
+}
+
+// Macros_ExpandLine handles the line at index *i. If the line starts a block, *i is moved to the end of that block.
+func Macros_ExpandLine(lines []SourceLine, i *int, conditionalBlocks *[]conditionalBlock, pass int, depth int, handleLine func(line SourceLine)) {
+	line := lines[*i]
+	if Conditionals_HandleLine(conditionalBlocks, line, pass) {
+		return
+	}
+
+	fields := strings.Fields(line.Text)
+	firstWord := strings.ToLower(fields[0])
+	argumentText := strings.TrimSpace(line.Text[len(fields[0]):])
+
+	switch firstWord {
+	case ".macro":
+		// skip over the block first, so that it's skipped even if something's wrong with it
+		body, end := Macros_FindBlockEnd(lines, *i, ".endm")
+		*i = end
+
+		if len(fields) < 2 {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Expected macro name")
+		}
+		name := strings.ToUpper(fields[1])
+		if _, exists := Macros_Table[name]; exists {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Tried to declare already existing macro '%s'", fields[1])
+		}
+		if _, isInstruction := OpCodes_Table[name]; isInstruction {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Macro '%s' has the same name as an instruction", fields[1])
+		}
+
+		parameters := []string{}
+		parameterText := strings.TrimSpace(strings.TrimPrefix(argumentText, fields[1]))
+		if parameterText != "" {
+			for _, parameter := range Macros_SplitArguments(parameterText) {
+				parameters = append(parameters, strings.TrimSpace(parameter))
+			}
+		}
+
+		Macros_Table[name] = &Macro{fields[1], parameters, body, line.FileBase, line.LineNumber}
+
+	case ".rept":
+		body, end := Macros_FindBlockEnd(lines, *i, ".endr")
+		*i = end
+
+		if argumentText == "" {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Expected repetition count")
+		}
+		count := Assembler_GetConstant(argumentText, pass, line.FileBase, line.LineNumber)
+		if count < 0 {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Repetition count %d is negative", count)
+		}
+
+		for repetition := 0; repetition < count; repetition++ {
+			Macros_ExpandLines(Macros_Substitute(body, nil, nil), pass, depth+1, handleLine)
+		}
+
+	case ".irp":
+		body, end := Macros_FindBlockEnd(lines, *i, ".endr")
+		*i = end
+
+		arguments := Macros_SplitArguments(argumentText)
+		if strings.TrimSpace(arguments[0]) == "" {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Expected parameter name")
+		}
+		parameter := strings.TrimSpace(arguments[0])
+
+		for _, value := range arguments[1:] {
+			Macros_ExpandLines(Macros_Substitute(body, []string{parameter}, []string{strings.TrimSpace(value)}), pass, depth+1, handleLine)
+		}
+
+	case ".endm", ".endr":
+		diagnostics.Fatalf(line.FileBase, line.LineNumber, "Unexpected '%s'", fields[0])
+
+	default:
+		macro, isMacro := Macros_Table[strings.ToUpper(fields[0])]
+		if !isMacro {
+			handleLine(line)
+			return
+		}
+
+		arguments := []string{}
+		if argumentText != "" {
+			for _, argument := range Macros_SplitArguments(argumentText) {
+				arguments = append(arguments, strings.TrimSpace(argument))
+			}
+		}
+		if len(arguments) != len(macro.Parameters) {
+			diagnostics.Fatalf(line.FileBase, line.LineNumber, "Macro '%s' expects %d arguments, got %d", macro.Name, len(macro.Parameters), len(arguments))
+		}
+
+		Macros_ExpandLines(Macros_Substitute(macro.Lines, macro.Parameters, arguments), pass, depth+1, handleLine)
+	}
+}
+
+// Macros_FindBlockEnd finds the line that ends the block starting at the given line, and returns the lines inside of it.
+// Blocks inside of the block are skipped over.
+func Macros_FindBlockEnd(lines []SourceLine, start int, endDirective string) ([]SourceLine, int) {
+	nesting := 0
+	for i := start + 1; i < len(lines); i++ {
+		firstWord := strings.ToLower(strings.Fields(lines[i].Text)[0])
+		switch firstWord {
+		case ".macro", ".rept", ".irp":
+			nesting++
+		case ".endm", ".endr":
+			if nesting == 0 {
+				if firstWord != endDirective {
+					diagnostics.Fatalf(lines[i].FileBase, lines[i].LineNumber, "Expected '%s', got '%s'", endDirective, firstWord)
+				}
+				return lines[start+1 : i], i
+			}
+			nesting--
+		}
+	}
+
+	// skip everything after it, since there's no way to know where the block was supposed to end
+	diagnostics.Errorf(lines[start].FileBase, lines[start].LineNumber, "Missing '%s' for block", endDirective)
+	return nil, len(lines) - 1
+}
+
+// Macros_Substitute returns a copy of the given lines with the parameters replaced by their values.
+// Parameters can be used by name (\name) or by position (\1), and \@ becomes a number that's unique to this expansion.
+func Macros_Substitute(lines []SourceLine, parameters []string, values []string) []SourceLine {
+	Macros_ExpansionCount++
+	uniqueSuffix := "_" + strconv.Itoa(Macros_ExpansionCount)
+
+	result := make([]SourceLine, len(lines))
+	for lineIndex, line := range lines {
+		text := ""
+		for i := 0; i < len(line.Text); i++ {
+			char := line.Text[i]
+			if char != '\\' || i+1 >= len(line.Text) {
+				text += string(char)
+				continue
+			}
+
+			if line.Text[i+1] == '@' {
+				text += uniqueSuffix
+				i++
+				continue
+			}
+
+			// find the name after the backslash
+			nameEnd := i + 1
+			for nameEnd < len(line.Text) && Macros_IsNameCharacter(line.Text[nameEnd]) {
+				nameEnd++
+			}
+			name := line.Text[i+1 : nameEnd]
+
+			position, err := strconv.Atoi(name)
+			if err == nil && position >= 1 && position <= len(values) {
+				text += values[position-1]
+				i = nameEnd - 1
+				continue
+			}
+
+			found := false
+			for parameterIndex, parameter := range parameters {
+				if parameter == name {
+					text += values[parameterIndex]
+					found = true
+					break
+				}
+			}
+			if !found {
+				diagnostics.Fatalf(line.FileBase, line.LineNumber, "Unknown macro parameter '\\%s'", name)
+			}
+			i = nameEnd - 1
+		}
+		result[lineIndex] = SourceLine{text, line.FileBase, line.LineNumber, line.Column}
+	}
+	return result
+}
+
+// Macros_SplitArguments splits the given text at commas, except for commas inside of strings, brackets, or parentheses.
+func Macros_SplitArguments(text string) []string {
+	arguments := []string{}
+	buf := ""
+	nesting := 0
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+		if quote != 0 {
+			if char == quote {
+				quote = 0
+			}
+		} else if char == '"' || char == '\'' {
+			quote = char
+		} else if char == '(' || char == '[' {
+			nesting++
+		} else if char == ')' || char == ']' {
+			nesting--
+		} else if char == ',' && nesting == 0 {
+			arguments = append(arguments, buf)
+			buf = ""
+			continue
+		}
+		buf += string(char)
+	}
+	return append(arguments, buf)
+}
+
+// Macros_IsNameCharacter returns true if the given character can be part of a parameter name.
+func Macros_IsNameCharacter(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_'
+}
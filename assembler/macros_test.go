@@ -0,0 +1,94 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func expandTestLines(source string) []string {
+	rom.Current.Definitions = map[string]int{"COUNT": 2}
+	rom.Current.DeclaredConstants = []string{"COUNT"}
+	Macros_Reset()
+
+	lines := []SourceLine{}
+	for i, text := range strings.Split(strings.TrimSpace(source), "\n") {
+		lines = append(lines, SourceLine{strings.TrimSpace(text), "test.s", i + 1, 1})
+	}
+
+	result := []string{}
+	Macros_ExpandLines(lines, 1, 0, func(line SourceLine) {
+		result = append(result, line.Text)
+	})
+	return result
+}
+
+func TestExpandMacros(t *testing.T) {
+	result := expandTestLines(`
+		.macro load reg, value
+		loop\@:
+		ld \reg, \2
+		.endm
+		load a, [hl]
+		LOAD b, 5
+		.rept COUNT
+		nop
+		.endr
+		.irp r, b, c
+		inc \r
+		.endr
+	`)
+	expected := []string{
+		"loop_1:", "ld a, [hl]",
+		"loop_2:", "ld b, 5",
+		"nop", "nop",
+		"inc b", "inc c",
+	}
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expanded to %q, should have been %q", result, expected)
+	}
+}
+
+func TestSplitArguments(t *testing.T) {
+	result := Macros_SplitArguments(`"a, b", [hl], (1, 2), 3`)
+	expected := []string{`"a, b"`, ` [hl]`, ` (1, 2)`, ` 3`}
+	if strings.Join(result, "|") != strings.Join(expected, "|") {
+		t.Errorf("Split into %q, should have been %q", result, expected)
+	}
+}
+
+func TestExpandConditionals(t *testing.T) {
+	result := expandTestLines(`
+		.if COUNT == 1
+		wrong
+		.elif COUNT - 2
+		wrong
+		.elif COUNT
+		right1
+		.if 0
+		wrong
+		.else
+		right2
+		.endif
+		.else
+		wrong
+		.endif
+		.ifdef COUNT
+		right3
+		.endif
+		.ifndef MISSING
+		right4
+		.else
+		wrong
+		.endif
+		.if 0
+		.if MISSING
+		.endif
+		.endif
+	`)
+	expected := []string{"right1", "right2", "right3", "right4"}
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expanded to %q, should have been %q", result, expected)
+	}
+}
@@ -1,10 +1,10 @@
-package main
+package assembler
 
 import (
-	"log"
 	"strconv"
 	"strings"
 
+	"github.com/thatoddmailbox/gbasm/diagnostics"
 	"github.com/thatoddmailbox/gbasm/parser"
 	"github.com/thatoddmailbox/gbasm/utils"
 )
@@ -30,14 +30,19 @@ var OpCodes_Table = map[string]OpCodeInfo{
 	"DB":    OpCodeInfo{[]int{-1}},
 	"DW":    OpCodeInfo{[]int{-1}},
 
-	"ADD": OpCodeInfo{[]int{2}},
-	"ADC": OpCodeInfo{[]int{2}},
-	"SUB": OpCodeInfo{[]int{1}},
-	"SBC": OpCodeInfo{[]int{2}},
-	"AND": OpCodeInfo{[]int{1}},
-	"XOR": OpCodeInfo{[]int{1}},
-	"OR":  OpCodeInfo{[]int{1}},
-	"CP":  OpCodeInfo{[]int{1}},
+	"ADD": OpCodeInfo{[]int{1, 2}},
+	"ADC": OpCodeInfo{[]int{1, 2}},
+	"SUB": OpCodeInfo{[]int{1, 2}},
+	"SBC": OpCodeInfo{[]int{1, 2}},
+	"AND": OpCodeInfo{[]int{1, 2}},
+	"XOR": OpCodeInfo{[]int{1, 2}},
+	"OR":  OpCodeInfo{[]int{1, 2}},
+	"CP":  OpCodeInfo{[]int{1, 2}},
+
+	"RLCA": OpCodeInfo{[]int{0}},
+	"RRCA": OpCodeInfo{[]int{0}},
+	"RLA":  OpCodeInfo{[]int{0}},
+	"RRA":  OpCodeInfo{[]int{0}},
 
 	"RLC":  OpCodeInfo{[]int{1}},
 	"RRC":  OpCodeInfo{[]int{1}},
@@ -52,8 +57,11 @@ var OpCodes_Table = map[string]OpCodeInfo{
 	"RES":  OpCodeInfo{[]int{2}},
 	"SET":  OpCodeInfo{[]int{2}},
 	"CALL": OpCodeInfo{[]int{1, 2}},
+	"CCF":  OpCodeInfo{[]int{0}},
 	"CPL":  OpCodeInfo{[]int{0}},
+	"DAA":  OpCodeInfo{[]int{0}},
 	"JP":   OpCodeInfo{[]int{1, 2}},
+	"JR":   OpCodeInfo{[]int{1, 2}},
 	"DEC":  OpCodeInfo{[]int{1}},
 	"INC":  OpCodeInfo{[]int{1}},
 	"DI":   OpCodeInfo{[]int{0}},
@@ -68,6 +76,9 @@ var OpCodes_Table = map[string]OpCodeInfo{
 	"PUSH": OpCodeInfo{[]int{1}},
 	"RET":  OpCodeInfo{[]int{0, 1}},
 	"RETI": OpCodeInfo{[]int{0}},
+	"RST":  OpCodeInfo{[]int{1}},
+	"SCF":  OpCodeInfo{[]int{0}},
+	"STOP": OpCodeInfo{[]int{0}},
 }
 
 var OpCodes_Table_R = map[string]int{
@@ -131,7 +142,19 @@ var OpCodes_Table_ROT = map[string]int{
 func OpCodes_GetOperandAsNumber(instruction Instruction, i int, fileBase string, lineNumber int) int {
 	num, ok := parser.ParseNumber(instruction.Operands[i])
 	if !ok {
-		log.Fatalf("Expected number, got '%s' at %s:%d", instruction.Operands[i], fileBase, lineNumber)
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", instruction.Operands[i])
+	}
+	return num
+}
+
+func OpCodes_GetOperandAsIndirectNumber(instruction Instruction, i int, fileBase string, lineNumber int) int {
+	operand := instruction.Operands[i]
+	if operand[0] != '[' || operand[len(operand)-1] != ']' {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected indirect address, got '%s'", operand)
+	}
+	num, ok := parser.ParseNumber(operand[1 : len(operand)-1])
+	if !ok {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", operand)
 	}
 	return num
 }
@@ -146,7 +169,7 @@ func OpCodes_GetOperandAsRegister8(instruction Instruction, i int, canBeIndirect
 	foundType := OpCodes_GetOperandType(instruction, i, false)
 	if foundType != OperandRegister8 {
 		if !canBeIndirectHL || instruction.Operands[i] != "[HL]" {
-			log.Fatalf("Expected 8-bit register, got '%s' at %s:%d", instruction.Operands[i], fileBase, lineNumber)
+			diagnostics.Fatalf(fileBase, lineNumber, "Expected 8-bit register, got '%s'", instruction.Operands[i])
 		}
 	}
 	return instruction.Operands[i]
@@ -155,7 +178,7 @@ func OpCodes_GetOperandAsRegister8(instruction Instruction, i int, canBeIndirect
 func OpCodes_GetOperandAsRegister16(instruction Instruction, i int, fileBase string, lineNumber int) string {
 	foundType := OpCodes_GetOperandType(instruction, i, false)
 	if foundType != OperandRegister16 {
-		log.Fatalf("Expected 16-bit register, got '%s' at %s:%d", instruction.Operands[i], fileBase, lineNumber)
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected 16-bit register, got '%s'", instruction.Operands[i])
 	}
 	return instruction.Operands[i]
 }
@@ -163,11 +186,46 @@ func OpCodes_GetOperandAsRegister16(instruction Instruction, i int, fileBase str
 func OpCodes_GetOperandAsString(instruction Instruction, i int, fileBase string, lineNumber int) string {
 	foundType := OpCodes_GetOperandType(instruction, i, false)
 	if foundType != OperandString {
-		log.Fatalf("Expected string, got '%s' at %s:%d", instruction.Operands[i], fileBase, lineNumber)
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected string, got '%s'", instruction.Operands[i])
 	}
 	return instruction.Operands[i][1 : len(instruction.Operands[i])-1]
 }
 
+func OpCodes_GetOperandAsConditionCode(instruction Instruction, i int, fileBase string, lineNumber int) int {
+	foundType := OpCodes_GetOperandType(instruction, i, true)
+	if foundType != OperandConditionCode || OpCodes_Table_CC[instruction.Operands[i]] > 3 {
+		// the LR35902 only has the first four condition codes
+		diagnostics.Fatalf(fileBase, lineNumber, "Invalid condition code '%s' for %s", instruction.Operands[i], instruction.Mnemonic)
+	}
+	return OpCodes_Table_CC[instruction.Operands[i]]
+}
+
+func OpCodes_GetOperandAsSignedByte(instruction Instruction, i int, fileBase string, lineNumber int) byte {
+	num := OpCodes_GetOperandAsNumber(instruction, i, fileBase, lineNumber)
+	OpCodes_EnsureNumberIsSignedByte(num, fileBase, lineNumber)
+	return byte(num & 0xFF)
+}
+
+func OpCodes_IsStackPointerOffset(operand string) bool {
+	return strings.HasPrefix(operand, "SP+") || strings.HasPrefix(operand, "SP-")
+}
+
+func OpCodes_GetOperandAsStackPointerOffset(instruction Instruction, i int, fileBase string, lineNumber int) byte {
+	operand := instruction.Operands[i]
+	if !OpCodes_IsStackPointerOffset(operand) {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected stack pointer offset, got '%s'", operand)
+	}
+	num, ok := parser.ParseNumber(operand[3:])
+	if !ok {
+		diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", operand[3:])
+	}
+	if operand[2] == '-' {
+		num = -num
+	}
+	OpCodes_EnsureNumberIsSignedByte(num, fileBase, lineNumber)
+	return byte(num & 0xFF)
+}
+
 func OpCodes_GetOperandType(instruction Instruction, i int, canBeConditionCode bool) OperandType {
 	operand := instruction.Operands[i]
 	if canBeConditionCode && utils.StringInSlice(operand, parser.ConditionCodes) {
@@ -187,8 +245,15 @@ func OpCodes_GetOperandType(instruction Instruction, i int, canBeConditionCode b
 }
 
 func OpCodes_EnsureNumberIsByte(num int, fileBase string, lineNumber int) {
-	if num < 0 || num > 255 {
-		log.Fatalf("Byte value %d out of range at %s:%d", num, fileBase, lineNumber)
+	// negative numbers are fine, they're stored as two's complement
+	if num < -128 || num > 255 {
+		diagnostics.Fatalf(fileBase, lineNumber, "Byte value %d out of range", num)
+	}
+}
+
+func OpCodes_EnsureNumberIsSignedByte(num int, fileBase string, lineNumber int) {
+	if num < -128 || num > 127 {
+		diagnostics.Fatalf(fileBase, lineNumber, "Signed byte value %d out of range", num)
 	}
 }
 
@@ -200,15 +265,15 @@ func OpCodes_AsmXZY(x int, z int, y int) byte {
 	return byte((x << 6) | (y << 3) | z)
 }
 
-func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int) []byte {
+func OpCodes_GetOutput(instruction Instruction, address int, pass int, fileBase string, lineNumber int) []byte {
 	info, ok := OpCodes_Table[instruction.Mnemonic]
 
 	if !ok {
-		log.Fatalf("Unknown instruction '%s' at %s:%d", instruction.Mnemonic, fileBase, lineNumber)
+		diagnostics.Fatalf(fileBase, lineNumber, "Unknown instruction '%s'", instruction.Mnemonic)
 	}
 
 	if info.ValidOperandCounts[0] != -1 && !utils.IntInSlice(len(instruction.Operands), info.ValidOperandCounts) {
-		log.Fatalf("Incorrect number of operands for instruction '%s' (got %d) at %s:%d", instruction.Mnemonic, len(instruction.Operands), fileBase, lineNumber)
+		diagnostics.Fatalf(fileBase, lineNumber, "Incorrect number of operands for instruction '%s' (got %d)", instruction.Mnemonic, len(instruction.Operands))
 	}
 
 	var err error
@@ -237,6 +302,10 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 		output := []byte{}
 		for i := 0; i < len(instruction.Operands); i++ {
 			num := OpCodes_GetOperandAsNumber(instruction, i, fileBase, lineNumber)
+			if pass == 1 && (num < -0x8000 || num > 0xFFFF) {
+				// only the low 16 bits are kept, which is probably not what was meant. labels are placeholders until the last pass
+				diagnostics.Warningf(fileBase, lineNumber, "Word value %d out of range, it was truncated to 0x%04X", num, num&0xFFFF)
+			}
 			output = append(output, byte(num&0xFF))
 			output = append(output, byte(num>>8))
 		}
@@ -259,16 +328,25 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 	case "CP":
 		if len(instruction.Operands) == 2 {
 			if instruction.Operands[0] != "A" {
-				if instruction.Mnemonic != "ADD" || instruction.Operands[0] != "HL" {
-					log.Fatalf("Invalid operand '%s' for %s at %s:%d", instruction.Operands[0], instruction.Mnemonic, fileBase, lineNumber)
+				if instruction.Mnemonic != "ADD" || (instruction.Operands[0] != "HL" && instruction.Operands[0] != "SP") {
+					diagnostics.Fatalf(fileBase, lineNumber, "Invalid operand '%s' for %s", instruction.Operands[0], instruction.Mnemonic)
 				}
 			}
-		}
 
-		if instruction.Mnemonic == "ADD" && instruction.Operands[0] == "HL" {
-			// yay special case
-			srcVal := OpCodes_GetOperandAsRegister16(instruction, 1, fileBase, lineNumber)
-			return []byte{OpCodes_AsmXZQP(0, 1, 1, OpCodes_Table_RP[srcVal])}
+			if instruction.Mnemonic == "ADD" && instruction.Operands[0] == "HL" {
+				// yay special case
+				srcVal := OpCodes_GetOperandAsRegister16(instruction, 1, fileBase, lineNumber)
+				srcIndex, ok := OpCodes_Table_RP[srcVal]
+				if !ok {
+					diagnostics.Fatalf(fileBase, lineNumber, "Invalid operand '%s' for %s", srcVal, instruction.Mnemonic)
+				}
+				return []byte{OpCodes_AsmXZQP(0, 1, 1, srcIndex)}
+			}
+
+			if instruction.Mnemonic == "ADD" && instruction.Operands[0] == "SP" {
+				// another special case, with a signed offset
+				return []byte{0xE8, OpCodes_GetOperandAsSignedByte(instruction, 1, fileBase, lineNumber)}
+			}
 		}
 
 		targetIndex := len(instruction.Operands) - 1
@@ -282,9 +360,21 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 			targetVal := OpCodes_Table_R[instruction.Operands[targetIndex]]
 			return []byte{OpCodes_AsmXZY(2, targetVal, yVal)}
 		} else {
-			log.Fatalf("Invalid operand '%s' for %s at %s:%d", instruction.Operands[targetIndex], instruction.Mnemonic, fileBase, lineNumber)
+			diagnostics.Fatalf(fileBase, lineNumber, "Invalid operand '%s' for %s", instruction.Operands[targetIndex], instruction.Mnemonic)
 		}
 
+	case "RLCA":
+		return []byte{0x07}
+
+	case "RRCA":
+		return []byte{0x0F}
+
+	case "RLA":
+		return []byte{0x17}
+
+	case "RRA":
+		return []byte{0x1F}
+
 	case "RLC":
 		fallthrough
 	case "RRC":
@@ -336,24 +426,58 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 			} else if instruction.Mnemonic == "JP" && (instruction.Operands[0] == "HL" || instruction.Operands[0] == "[HL]") {
 				return []byte{OpCodes_AsmXZQP(3, 1, 1, 2)}
 			} else {
-				log.Fatalf("Invalid operand '%s' for %s at %s:%d", instruction.Operands[0], instruction.Mnemonic, fileBase, lineNumber)
+				diagnostics.Fatalf(fileBase, lineNumber, "Invalid operand '%s' for %s", instruction.Operands[0], instruction.Mnemonic)
 			}
 		} else {
 			// jump with condition code
-			if firstType != OperandConditionCode {
-				log.Fatalf("Invalid condition code '%s' for %s at %s:%d", instruction.Operands[0], instruction.Mnemonic, fileBase, lineNumber)
-			}
+			conditionCode := OpCodes_GetOperandAsConditionCode(instruction, 0, fileBase, lineNumber)
 			target := OpCodes_GetOperandAsNumber(instruction, 1, fileBase, lineNumber)
 			z := 2
 			if instruction.Mnemonic == "CALL" {
 				z = 4
 			}
-			return []byte{OpCodes_AsmXZY(3, z, OpCodes_Table_CC[instruction.Operands[0]]), byte(target & 0xFF), byte(target >> 8)}
+			return []byte{OpCodes_AsmXZY(3, z, conditionCode), byte(target & 0xFF), byte(target >> 8)}
+		}
+
+	case "JR":
+		firstByte := OpCodes_AsmXZY(0, 0, 3)
+		if len(instruction.Operands) == 2 {
+			// jump with condition code
+			firstByte = OpCodes_AsmXZY(0, 0, OpCodes_GetOperandAsConditionCode(instruction, 0, fileBase, lineNumber)+4)
+		}
+		target := OpCodes_GetOperandAsNumber(instruction, len(instruction.Operands)-1, fileBase, lineNumber)
+
+		// the offset is relative to the end of the JR instruction
+		offset := target - (address + 2)
+		if pass != 0 && (offset < -128 || offset > 127) {
+			// labels aren't pointed yet on the first pass, so only check on the second
+			diagnostics.Fatalf(fileBase, lineNumber, "Target of %s is too far away (%d bytes)", instruction.Mnemonic, offset)
+		}
+		return []byte{firstByte, byte(offset & 0xFF)}
+
+	case "RST":
+		target := OpCodes_GetOperandAsNumber(instruction, 0, fileBase, lineNumber)
+		if target < 0 || target > 0x38 || target%8 != 0 {
+			diagnostics.Fatalf(fileBase, lineNumber, "Invalid restart vector %d for %s", target, instruction.Mnemonic)
 		}
+		return []byte{OpCodes_AsmXZY(3, 7, target/8)}
+
+	case "CCF":
+		return []byte{0x3F}
 
 	case "CPL":
 		return []byte{0x2F}
 
+	case "DAA":
+		return []byte{0x27}
+
+	case "SCF":
+		return []byte{0x37}
+
+	case "STOP":
+		// STOP is followed by a padding byte
+		return []byte{0x10, 0x00}
+
 	case "DEC":
 		fallthrough
 	case "INC":
@@ -367,14 +491,17 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 				return []byte{OpCodes_AsmXZY(0, 5, targetVal)}
 			}
 		} else if targetType == OperandRegister16 {
-			targetVal := OpCodes_Table_RP[instruction.Operands[0]]
+			targetVal, ok := OpCodes_Table_RP[instruction.Operands[0]]
+			if !ok {
+				diagnostics.Fatalf(fileBase, lineNumber, "Invalid operand '%s' for %s", instruction.Operands[0], instruction.Mnemonic)
+			}
 			if isINC {
 				return []byte{OpCodes_AsmXZQP(0, 3, 0, targetVal)}
 			} else {
 				return []byte{OpCodes_AsmXZQP(0, 3, 1, targetVal)}
 			}
 		} else {
-			log.Fatalf("Invalid operand '%s' for %s at %s:%d", instruction.Operands[0], instruction.Mnemonic, fileBase, lineNumber)
+			diagnostics.Fatalf(fileBase, lineNumber, "Invalid operand '%s' for %s", instruction.Operands[0], instruction.Mnemonic)
 		}
 
 	case "DI":
@@ -391,15 +518,46 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 		srcType := OpCodes_GetOperandType(instruction, 1, false)
 		dstVal := 0
 		srcVal := 0
+		dstIsPair := false // only BC, DE, HL, and SP can be loaded with a 16-bit value
+
+		// first, the forms that don't fit the usual patterns
+		if instruction.Operands[0] == "[C]" && instruction.Operands[1] == "A" {
+			return []byte{0xE2}
+		}
+		if instruction.Operands[0] == "A" && instruction.Operands[1] == "[C]" {
+			return []byte{0xF2}
+		}
+		if (instruction.Operands[0] == "[HL+]" || instruction.Operands[0] == "[HLI]") && instruction.Operands[1] == "A" {
+			return []byte{0x22}
+		}
+		if (instruction.Operands[0] == "[HL-]" || instruction.Operands[0] == "[HLD]") && instruction.Operands[1] == "A" {
+			return []byte{0x32}
+		}
+		if instruction.Operands[0] == "A" && (instruction.Operands[1] == "[HL+]" || instruction.Operands[1] == "[HLI]") {
+			return []byte{0x2A}
+		}
+		if instruction.Operands[0] == "A" && (instruction.Operands[1] == "[HL-]" || instruction.Operands[1] == "[HLD]") {
+			return []byte{0x3A}
+		}
+		if instruction.Operands[0] == "SP" && instruction.Operands[1] == "HL" {
+			return []byte{0xF9}
+		}
+		if instruction.Operands[0] == "HL" && OpCodes_IsStackPointerOffset(instruction.Operands[1]) {
+			return []byte{0xF8, OpCodes_GetOperandAsStackPointerOffset(instruction, 1, fileBase, lineNumber)}
+		}
+		if dstType == OperandValueIndirect && instruction.Operands[1] == "SP" {
+			target := OpCodes_GetOperandAsIndirectNumber(instruction, 0, fileBase, lineNumber)
+			return []byte{0x08, byte(target & 0xFF), byte(target >> 8)}
+		}
 
 		if dstType == OperandRegister8 {
 			dstVal = OpCodes_Table_R[instruction.Operands[0]]
 		} else if dstType == OperandRegister16 {
-			dstVal = OpCodes_Table_RP[instruction.Operands[0]]
+			dstVal, dstIsPair = OpCodes_Table_RP[instruction.Operands[0]]
 		} else {
 			dstVal, err = strconv.Atoi(strings.Replace(strings.Replace(instruction.Operands[0], "[", "", -1), "]", "", -1))
 			if err != nil {
-				panic(err)
+				diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", instruction.Operands[0])
 			}
 		}
 
@@ -410,7 +568,7 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 		} else {
 			srcVal, err = strconv.Atoi(strings.Replace(strings.Replace(instruction.Operands[1], "[", "", -1), "]", "", -1))
 			if err != nil {
-				panic(err)
+				diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", instruction.Operands[1])
 			}
 		}
 
@@ -422,6 +580,10 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 			return []byte{byte((dstVal << 3) | 6), byte(srcVal & 0xFF)}
 		}
 		if (dstType == OperandRegister8 || instruction.Operands[0] == "[HL]") && (srcType == OperandRegister8 || instruction.Operands[1] == "[HL]") {
+			if instruction.Operands[0] == "[HL]" && instruction.Operands[1] == "[HL]" {
+				// that would be HALT
+				diagnostics.Fatalf(fileBase, lineNumber, "Invalid operands '%s' and '%s' for LD instruction", instruction.Operands[0], instruction.Operands[1])
+			}
 			if instruction.Operands[0] == "[HL]" {
 				dstVal = OpCodes_Table_R["[HL]"]
 			}
@@ -430,7 +592,7 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 			}
 			return []byte{byte(64 | (dstVal << 3) | srcVal)}
 		}
-		if dstType == OperandRegister16 && srcType == OperandValue {
+		if dstType == OperandRegister16 && dstIsPair && srcType == OperandValue {
 			return []byte{byte((dstVal << 4) | 1), byte(srcVal & 0xFF), byte(srcVal >> 8)}
 		}
 
@@ -455,7 +617,7 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 			return []byte{OpCodes_AsmXZQP(0, 2, 1, 1)}
 		}
 
-		log.Fatalf("Invalid operands '%s' and '%s' for LD instruction at %s:%d", instruction.Operands[0], instruction.Operands[1], fileBase, lineNumber)
+		diagnostics.Fatalf(fileBase, lineNumber, "Invalid operands '%s' and '%s' for LD instruction", instruction.Operands[0], instruction.Operands[1])
 
 	case "LDH":
 		dstType := OpCodes_GetOperandType(instruction, 0, false)
@@ -463,14 +625,18 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 		srcVal := 0
 		dstVal := 0
 
-		if instruction.Operands[0] == "A" && srcType == OperandValueIndirect {
+		if instruction.Operands[0] == "A" && instruction.Operands[1] == "[C]" {
+			return []byte{0xF2}
+		} else if instruction.Operands[0] == "[C]" && instruction.Operands[1] == "A" {
+			return []byte{0xE2}
+		} else if instruction.Operands[0] == "A" && srcType == OperandValueIndirect {
 			srcVal, err = strconv.Atoi(strings.Replace(strings.Replace(instruction.Operands[1], "[", "", -1), "]", "", -1))
 			if err != nil {
-				panic(err)
+				diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", instruction.Operands[1])
 			}
 
 			if instruction.Operands[0] != "A" {
-				log.Fatalf("LDH can only load into register A at %s:%d", fileBase, lineNumber)
+				diagnostics.Fatalf(fileBase, lineNumber, "LDH can only load into register A")
 			}
 			if srcVal >= 0xFF00 {
 				srcVal = srcVal - 0xFF00
@@ -480,11 +646,11 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 		} else if dstType == OperandValueIndirect && instruction.Operands[1] == "A" {
 			dstVal, err = strconv.Atoi(strings.Replace(strings.Replace(instruction.Operands[0], "[", "", -1), "]", "", -1))
 			if err != nil {
-				panic(err)
+				diagnostics.Fatalf(fileBase, lineNumber, "Expected number, got '%s'", instruction.Operands[0])
 			}
 
 			if instruction.Operands[1] != "A" {
-				log.Fatalf("LDH can only load from register A at %s:%d", fileBase, lineNumber)
+				diagnostics.Fatalf(fileBase, lineNumber, "LDH can only load from register A")
 			}
 			if dstVal >= 0xFF00 {
 				dstVal = dstVal - 0xFF00
@@ -492,7 +658,7 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 			OpCodes_EnsureNumberIsByte(dstVal, fileBase, lineNumber)
 			return []byte{0xE0, byte(dstVal & 0xFF)}
 		} else {
-			log.Fatalf("Invalid operands '%s' and '%s' for LDH instruction at %s:%d", instruction.Operands[0], instruction.Operands[1], fileBase, lineNumber)
+			diagnostics.Fatalf(fileBase, lineNumber, "Invalid operands '%s' and '%s' for LDH instruction", instruction.Operands[0], instruction.Operands[1])
 		}
 
 	case "LDI":
@@ -511,7 +677,7 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 				return []byte{0x32}
 			}
 		} else {
-			log.Fatalf("Invalid operands '%s' and '%s' for %s instruction at %s:%d", instruction.Operands[0], instruction.Operands[1], instruction.Mnemonic, fileBase, lineNumber)
+			diagnostics.Fatalf(fileBase, lineNumber, "Invalid operands '%s' and '%s' for %s instruction", instruction.Operands[0], instruction.Operands[1], instruction.Mnemonic)
 		}
 
 	case "NOP":
@@ -522,7 +688,7 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 	case "PUSH":
 		tableIndex, ok := OpCodes_Table_RP2[instruction.Operands[0]]
 		if !ok {
-			log.Fatalf("Invalid operand '%s' for %s instruction at %s:%d", instruction.Operands[0], instruction.Mnemonic, fileBase, lineNumber)
+			diagnostics.Fatalf(fileBase, lineNumber, "Invalid operand '%s' for %s instruction", instruction.Operands[0], instruction.Mnemonic)
 		}
 		zVal := 1
 		if instruction.Mnemonic == "PUSH" {
@@ -534,11 +700,7 @@ func OpCodes_GetOutput(instruction Instruction, fileBase string, lineNumber int)
 		if len(instruction.Operands) == 0 {
 			return []byte{OpCodes_AsmXZQP(3, 1, 1, 0)}
 		} else {
-			firstType := OpCodes_GetOperandType(instruction, 0, true)
-			if firstType != OperandConditionCode {
-				log.Fatalf("Invalid condition code '%s' for %s at %s:%d", instruction.Operands[0], instruction.Mnemonic, fileBase, lineNumber)
-			}
-			return []byte{OpCodes_AsmXZY(3, 0, OpCodes_Table_CC[instruction.Operands[0]])}
+			return []byte{OpCodes_AsmXZY(3, 0, OpCodes_GetOperandAsConditionCode(instruction, 0, fileBase, lineNumber))}
 		}
 
 	case "RETI":
@@ -0,0 +1,395 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/utils"
+)
+
+func displayInstruction(instruction Instruction) string {
+	return instruction.Mnemonic + " " + strings.Join(instruction.Operands, " ")
+}
+
+func prettyOutputArray(output []byte) string {
+	outStr := "["
+	for i, c := range output {
+		if i != 0 {
+			outStr += ", "
+		}
+		outStr += strconv.Itoa(int(c))
+	}
+	outStr += "]"
+	return outStr
+}
+
+func tryTestInput(t *testing.T, instruction Instruction, expectedOutput []byte) {
+	tryTestInputAt(t, instruction, 0, expectedOutput)
+}
+
+func tryTestInputAt(t *testing.T, instruction Instruction, address int, expectedOutput []byte) {
+	output := OpCodes_GetOutput(instruction, address, 1, "test", 0)
+	if !utils.ByteSlicesEqual(output, expectedOutput) {
+		t.Errorf("Instruction '%s' at %d assembled to %s, should have been %s", displayInstruction(instruction), address, prettyOutputArray(output), prettyOutputArray(expectedOutput))
+	}
+}
+
+func tryTestInvalidInput(t *testing.T, instruction Instruction) {
+	diagnostics.Reset()
+	if diagnostics.Try("test", 0, 0, func() { OpCodes_GetOutput(instruction, 0, 1, "test", 0) }) {
+		t.Errorf("Instruction '%s' should have been invalid", displayInstruction(instruction))
+	}
+	diagnostics.Reset()
+}
+
+func TestControlInstructions(t *testing.T) {
+	tryTestInput(t, Instruction{"CALL", []string{"1234"}}, []byte{0xCD, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"CALL", []string{"Z", "1234"}}, []byte{0xCC, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"JP", []string{"1234"}}, []byte{0xC3, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"JP", []string{"HL"}}, []byte{0xE9})
+	tryTestInput(t, Instruction{"JP", []string{"[HL]"}}, []byte{0xE9})
+	tryTestInput(t, Instruction{"JP", []string{"Z", "1234"}}, []byte{0xCA, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"RET", []string{}}, []byte{0xC9})
+	tryTestInput(t, Instruction{"RET", []string{"Z"}}, []byte{0xC8})
+	tryTestInput(t, Instruction{"RETI", []string{}}, []byte{0xD9})
+
+	tryTestInputAt(t, Instruction{"JR", []string{"1234"}}, 1232, []byte{0x18, 0x00})
+	tryTestInputAt(t, Instruction{"JR", []string{"1234"}}, 1200, []byte{0x18, 0x20})
+	tryTestInputAt(t, Instruction{"JR", []string{"1234"}}, 1234, []byte{0x18, 0xFE})
+	tryTestInputAt(t, Instruction{"JR", []string{"1234"}}, 1105, []byte{0x18, 0x7F})
+	tryTestInputAt(t, Instruction{"JR", []string{"1234"}}, 1360, []byte{0x18, 0x80})
+	tryTestInputAt(t, Instruction{"JR", []string{"NZ", "1234"}}, 1232, []byte{0x20, 0x00})
+	tryTestInputAt(t, Instruction{"JR", []string{"Z", "1234"}}, 1232, []byte{0x28, 0x00})
+	tryTestInputAt(t, Instruction{"JR", []string{"NC", "1234"}}, 1232, []byte{0x30, 0x00})
+	tryTestInputAt(t, Instruction{"JR", []string{"C", "1234"}}, 1232, []byte{0x38, 0x00})
+
+	tryTestInput(t, Instruction{"RST", []string{"0"}}, []byte{0xC7})
+	tryTestInput(t, Instruction{"RST", []string{"8"}}, []byte{0xCF})
+	tryTestInput(t, Instruction{"RST", []string{"56"}}, []byte{0xFF})
+}
+
+func TestBitInstructions(t *testing.T) {
+	tryTestInput(t, Instruction{"BIT", []string{"1", "A"}}, []byte{0xCB, 0x4F})
+	tryTestInput(t, Instruction{"BIT", []string{"2", "B"}}, []byte{0xCB, 0x50})
+	tryTestInput(t, Instruction{"BIT", []string{"3", "[HL]"}}, []byte{0xCB, 0x5E})
+
+	tryTestInput(t, Instruction{"RES", []string{"1", "A"}}, []byte{0xCB, 0x8F})
+	tryTestInput(t, Instruction{"RES", []string{"2", "B"}}, []byte{0xCB, 0x90})
+	tryTestInput(t, Instruction{"RES", []string{"3", "[HL]"}}, []byte{0xCB, 0x9E})
+
+	tryTestInput(t, Instruction{"SET", []string{"1", "A"}}, []byte{0xCB, 0xCF})
+	tryTestInput(t, Instruction{"SET", []string{"2", "B"}}, []byte{0xCB, 0xD0})
+	tryTestInput(t, Instruction{"SET", []string{"3", "[HL]"}}, []byte{0xCB, 0xDE})
+}
+
+func TestLoadInstructions(t *testing.T) {
+	tryTestInput(t, Instruction{"LD", []string{"A", "A"}}, []byte{0x7f})
+	tryTestInput(t, Instruction{"LD", []string{"A", "B"}}, []byte{0x78})
+	tryTestInput(t, Instruction{"LD", []string{"A", "C"}}, []byte{0x79})
+	tryTestInput(t, Instruction{"LD", []string{"A", "D"}}, []byte{0x7a})
+	tryTestInput(t, Instruction{"LD", []string{"A", "E"}}, []byte{0x7b})
+	tryTestInput(t, Instruction{"LD", []string{"A", "H"}}, []byte{0x7c})
+	tryTestInput(t, Instruction{"LD", []string{"A", "L"}}, []byte{0x7d})
+	tryTestInput(t, Instruction{"LD", []string{"B", "66"}}, []byte{0x06, 0x42})
+	tryTestInput(t, Instruction{"LD", []string{"BC", "1234"}}, []byte{0x01, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"LD", []string{"[HL]", "66"}}, []byte{0x36, 0x42})
+	tryTestInput(t, Instruction{"LD", []string{"[BC]", "A"}}, []byte{0x02})
+	tryTestInput(t, Instruction{"LD", []string{"[DE]", "A"}}, []byte{0x12})
+	tryTestInput(t, Instruction{"LD", []string{"[HL]", "A"}}, []byte{0x77})
+	tryTestInput(t, Instruction{"LD", []string{"A", "[HL]"}}, []byte{0x7E})
+	tryTestInput(t, Instruction{"LD", []string{"[1234]", "A"}}, []byte{0xEA, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"LD", []string{"A", "[1234]"}}, []byte{0xFA, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"LDH", []string{"A", "[40]"}}, []byte{0xF0, 0x28})
+	tryTestInput(t, Instruction{"LDH", []string{"A", "[65320]"}}, []byte{0xF0, 0x28})
+	tryTestInput(t, Instruction{"LDH", []string{"[40]", "A"}}, []byte{0xE0, 0x28})
+	tryTestInput(t, Instruction{"LDH", []string{"[65320]", "A"}}, []byte{0xE0, 0x28})
+	tryTestInput(t, Instruction{"LDI", []string{"[HL]", "A"}}, []byte{0x22})
+	tryTestInput(t, Instruction{"LDI", []string{"A", "[HL]"}}, []byte{0x2A})
+	tryTestInput(t, Instruction{"LDD", []string{"[HL]", "A"}}, []byte{0x32})
+	tryTestInput(t, Instruction{"LDD", []string{"A", "[HL]"}}, []byte{0x3A})
+
+	tryTestInput(t, Instruction{"LD", []string{"[HL+]", "A"}}, []byte{0x22})
+	tryTestInput(t, Instruction{"LD", []string{"A", "[HL+]"}}, []byte{0x2A})
+	tryTestInput(t, Instruction{"LD", []string{"[HL-]", "A"}}, []byte{0x32})
+	tryTestInput(t, Instruction{"LD", []string{"A", "[HL-]"}}, []byte{0x3A})
+	tryTestInput(t, Instruction{"LD", []string{"[C]", "A"}}, []byte{0xE2})
+	tryTestInput(t, Instruction{"LD", []string{"A", "[C]"}}, []byte{0xF2})
+	tryTestInput(t, Instruction{"LDH", []string{"[C]", "A"}}, []byte{0xE2})
+	tryTestInput(t, Instruction{"LDH", []string{"A", "[C]"}}, []byte{0xF2})
+	tryTestInput(t, Instruction{"LD", []string{"SP", "HL"}}, []byte{0xF9})
+	tryTestInput(t, Instruction{"LD", []string{"SP", "1234"}}, []byte{0x31, 0xD2, 0x04})
+	tryTestInput(t, Instruction{"LD", []string{"HL", "SP+5"}}, []byte{0xF8, 0x05})
+	tryTestInput(t, Instruction{"LD", []string{"HL", "SP-5"}}, []byte{0xF8, 0xFB})
+	tryTestInput(t, Instruction{"LD", []string{"[1234]", "SP"}}, []byte{0x08, 0xD2, 0x04})
+
+	// these look like 16-bit registers, but they can't be loaded with a value
+	tryTestInvalidInput(t, Instruction{"LD", []string{"[C]", "1"}})
+	tryTestInvalidInput(t, Instruction{"LD", []string{"[HL+]", "5"}})
+	tryTestInvalidInput(t, Instruction{"LD", []string{"[HL-]", "5"}})
+	tryTestInvalidInput(t, Instruction{"LD", []string{"[HLI]", "1"}})
+	tryTestInvalidInput(t, Instruction{"LD", []string{"[HLD]", "1"}})
+	tryTestInvalidInput(t, Instruction{"LD", []string{"[BC]", "1"}})
+	tryTestInvalidInput(t, Instruction{"LD", []string{"AF", "1234"}})
+	tryTestInvalidInput(t, Instruction{"LD", []string{"[HL]", "[HL]"}})
+}
+
+func TestALUInstructions(t *testing.T) {
+	tryTestInput(t, Instruction{"ADD", []string{"A", "66"}}, []byte{0xC6, 0x42})
+	tryTestInput(t, Instruction{"ADD", []string{"A", "B"}}, []byte{0x80})
+	tryTestInput(t, Instruction{"ADD", []string{"A", "[HL]"}}, []byte{0x86})
+	tryTestInput(t, Instruction{"ADD", []string{"66"}}, []byte{0xC6, 0x42})
+	tryTestInput(t, Instruction{"ADD", []string{"B"}}, []byte{0x80})
+
+	tryTestInput(t, Instruction{"ADD", []string{"HL", "BC"}}, []byte{0x09})
+	tryTestInput(t, Instruction{"ADD", []string{"HL", "DE"}}, []byte{0x19})
+	tryTestInput(t, Instruction{"ADD", []string{"HL", "HL"}}, []byte{0x29})
+	tryTestInput(t, Instruction{"ADD", []string{"HL", "SP"}}, []byte{0x39})
+
+	tryTestInput(t, Instruction{"ADD", []string{"SP", "5"}}, []byte{0xE8, 0x05})
+	tryTestInput(t, Instruction{"ADD", []string{"SP", "-5"}}, []byte{0xE8, 0xFB})
+
+	tryTestInput(t, Instruction{"ADC", []string{"A", "66"}}, []byte{0xCE, 0x42})
+	tryTestInput(t, Instruction{"ADC", []string{"A", "B"}}, []byte{0x88})
+	tryTestInput(t, Instruction{"ADC", []string{"A", "[HL]"}}, []byte{0x8E})
+	tryTestInput(t, Instruction{"ADC", []string{"66"}}, []byte{0xCE, 0x42})
+	tryTestInput(t, Instruction{"ADC", []string{"B"}}, []byte{0x88})
+
+	tryTestInput(t, Instruction{"SUB", []string{"66"}}, []byte{0xD6, 0x42})
+	tryTestInput(t, Instruction{"SUB", []string{"B"}}, []byte{0x90})
+	tryTestInput(t, Instruction{"SUB", []string{"[HL]"}}, []byte{0x96})
+	tryTestInput(t, Instruction{"SUB", []string{"A", "66"}}, []byte{0xD6, 0x42})
+	tryTestInput(t, Instruction{"SUB", []string{"A", "B"}}, []byte{0x90})
+
+	tryTestInput(t, Instruction{"SBC", []string{"A", "66"}}, []byte{0xDE, 0x42})
+	tryTestInput(t, Instruction{"SBC", []string{"A", "B"}}, []byte{0x98})
+	tryTestInput(t, Instruction{"SBC", []string{"A", "[HL]"}}, []byte{0x9E})
+	tryTestInput(t, Instruction{"SBC", []string{"66"}}, []byte{0xDE, 0x42})
+	tryTestInput(t, Instruction{"SBC", []string{"B"}}, []byte{0x98})
+
+	tryTestInput(t, Instruction{"AND", []string{"66"}}, []byte{0xE6, 0x42})
+	tryTestInput(t, Instruction{"AND", []string{"B"}}, []byte{0xA0})
+	tryTestInput(t, Instruction{"AND", []string{"[HL]"}}, []byte{0xA6})
+	tryTestInput(t, Instruction{"AND", []string{"A", "66"}}, []byte{0xE6, 0x42})
+	tryTestInput(t, Instruction{"AND", []string{"A", "B"}}, []byte{0xA0})
+
+	tryTestInput(t, Instruction{"XOR", []string{"66"}}, []byte{0xEE, 0x42})
+	tryTestInput(t, Instruction{"XOR", []string{"B"}}, []byte{0xA8})
+	tryTestInput(t, Instruction{"XOR", []string{"[HL]"}}, []byte{0xAE})
+	tryTestInput(t, Instruction{"XOR", []string{"A", "66"}}, []byte{0xEE, 0x42})
+	tryTestInput(t, Instruction{"XOR", []string{"A", "B"}}, []byte{0xA8})
+
+	tryTestInput(t, Instruction{"OR", []string{"66"}}, []byte{0xF6, 0x42})
+	tryTestInput(t, Instruction{"OR", []string{"B"}}, []byte{0xB0})
+	tryTestInput(t, Instruction{"OR", []string{"[HL]"}}, []byte{0xB6})
+	tryTestInput(t, Instruction{"OR", []string{"A", "66"}}, []byte{0xF6, 0x42})
+	tryTestInput(t, Instruction{"OR", []string{"A", "B"}}, []byte{0xB0})
+
+	tryTestInput(t, Instruction{"CP", []string{"66"}}, []byte{0xFE, 0x42})
+	tryTestInput(t, Instruction{"CP", []string{"A"}}, []byte{0xBF})
+	tryTestInput(t, Instruction{"CP", []string{"[HL]"}}, []byte{0xBE})
+	tryTestInput(t, Instruction{"CP", []string{"A", "66"}}, []byte{0xFE, 0x42})
+	tryTestInput(t, Instruction{"CP", []string{"A", "B"}}, []byte{0xB8})
+}
+
+func TestMathInstructions(t *testing.T) {
+	tryTestInput(t, Instruction{"DEC", []string{"A"}}, []byte{0x3D})
+	tryTestInput(t, Instruction{"DEC", []string{"HL"}}, []byte{0x2B})
+	tryTestInput(t, Instruction{"INC", []string{"A"}}, []byte{0x3C})
+	tryTestInput(t, Instruction{"INC", []string{"BC"}}, []byte{0x03})
+	tryTestInput(t, Instruction{"INC", []string{"HL"}}, []byte{0x23})
+	tryTestInput(t, Instruction{"INC", []string{"[HL]"}}, []byte{0x34})
+}
+
+func TestROTInstructions(t *testing.T) {
+	tryTestInput(t, Instruction{"CPL", []string{}}, []byte{0x2F})
+
+	tryTestInput(t, Instruction{"RLCA", []string{}}, []byte{0x07})
+	tryTestInput(t, Instruction{"RRCA", []string{}}, []byte{0x0F})
+	tryTestInput(t, Instruction{"RLA", []string{}}, []byte{0x17})
+	tryTestInput(t, Instruction{"RRA", []string{}}, []byte{0x1F})
+
+	tryTestInput(t, Instruction{"RLC", []string{"A"}}, []byte{0xCB, 0x07})
+	tryTestInput(t, Instruction{"RLC", []string{"B"}}, []byte{0xCB, 0x00})
+	tryTestInput(t, Instruction{"RLC", []string{"[HL]"}}, []byte{0xCB, 0x06})
+
+	tryTestInput(t, Instruction{"RRC", []string{"A"}}, []byte{0xCB, 0x0F})
+	tryTestInput(t, Instruction{"RRC", []string{"B"}}, []byte{0xCB, 0x08})
+	tryTestInput(t, Instruction{"RRC", []string{"[HL]"}}, []byte{0xCB, 0x0E})
+
+	tryTestInput(t, Instruction{"RL", []string{"A"}}, []byte{0xCB, 0x17})
+	tryTestInput(t, Instruction{"RL", []string{"B"}}, []byte{0xCB, 0x10})
+	tryTestInput(t, Instruction{"RL", []string{"[HL]"}}, []byte{0xCB, 0x16})
+
+	tryTestInput(t, Instruction{"RR", []string{"A"}}, []byte{0xCB, 0x1F})
+	tryTestInput(t, Instruction{"RR", []string{"B"}}, []byte{0xCB, 0x18})
+	tryTestInput(t, Instruction{"RR", []string{"[HL]"}}, []byte{0xCB, 0x1E})
+
+	tryTestInput(t, Instruction{"SLA", []string{"A"}}, []byte{0xCB, 0x27})
+	tryTestInput(t, Instruction{"SLA", []string{"B"}}, []byte{0xCB, 0x20})
+	tryTestInput(t, Instruction{"SLA", []string{"[HL]"}}, []byte{0xCB, 0x26})
+
+	tryTestInput(t, Instruction{"SRA", []string{"A"}}, []byte{0xCB, 0x2F})
+	tryTestInput(t, Instruction{"SRA", []string{"B"}}, []byte{0xCB, 0x28})
+	tryTestInput(t, Instruction{"SRA", []string{"[HL]"}}, []byte{0xCB, 0x2E})
+
+	tryTestInput(t, Instruction{"SWAP", []string{"A"}}, []byte{0xCB, 0x37})
+	tryTestInput(t, Instruction{"SWAP", []string{"B"}}, []byte{0xCB, 0x30})
+	tryTestInput(t, Instruction{"SWAP", []string{"[HL]"}}, []byte{0xCB, 0x36})
+
+	tryTestInput(t, Instruction{"SRL", []string{"A"}}, []byte{0xCB, 0x3F})
+	tryTestInput(t, Instruction{"SRL", []string{"B"}}, []byte{0xCB, 0x38})
+	tryTestInput(t, Instruction{"SRL", []string{"[HL]"}}, []byte{0xCB, 0x3E})
+}
+
+func TestMiscInstructions(t *testing.T) {
+	tryTestInput(t, Instruction{"DB", []string{"66"}}, []byte{0x42})
+	tryTestInput(t, Instruction{"DB", []string{"66", "66"}}, []byte{0x42, 0x42})
+	tryTestInput(t, Instruction{"DB", []string{"66", "66", "66"}}, []byte{0x42, 0x42, 0x42})
+	tryTestInput(t, Instruction{"DW", []string{"1234"}}, []byte{0xD2, 0x04})
+
+	tryTestInput(t, Instruction{"ASCII", []string{"\"hello\""}}, []byte{0x68, 0x65, 0x6C, 0x6C, 0x6F})
+	tryTestInput(t, Instruction{"ASCIZ", []string{"\"hello\""}}, []byte{0x68, 0x65, 0x6C, 0x6C, 0x6F, 0x00})
+
+	tryTestInput(t, Instruction{"DI", []string{}}, []byte{0xF3})
+	tryTestInput(t, Instruction{"EI", []string{}}, []byte{0xFB})
+	tryTestInput(t, Instruction{"HALT", []string{}}, []byte{0x76})
+	tryTestInput(t, Instruction{"NOP", []string{}}, []byte{0x00})
+	tryTestInput(t, Instruction{"STOP", []string{}}, []byte{0x10, 0x00})
+	tryTestInput(t, Instruction{"DAA", []string{}}, []byte{0x27})
+	tryTestInput(t, Instruction{"SCF", []string{}}, []byte{0x37})
+	tryTestInput(t, Instruction{"CCF", []string{}}, []byte{0x3F})
+	tryTestInput(t, Instruction{"PUSH", []string{"BC"}}, []byte{0xC5})
+	tryTestInput(t, Instruction{"PUSH", []string{"DE"}}, []byte{0xD5})
+	tryTestInput(t, Instruction{"PUSH", []string{"HL"}}, []byte{0xE5})
+	tryTestInput(t, Instruction{"PUSH", []string{"AF"}}, []byte{0xF5})
+	tryTestInput(t, Instruction{"POP", []string{"BC"}}, []byte{0xC1})
+	tryTestInput(t, Instruction{"POP", []string{"DE"}}, []byte{0xD1})
+	tryTestInput(t, Instruction{"POP", []string{"HL"}}, []byte{0xE1})
+	tryTestInput(t, Instruction{"POP", []string{"AF"}}, []byte{0xF1})
+}
+
+type opCodeTestCase struct {
+	instruction    Instruction
+	expectedOutput []byte
+}
+
+// allOpCodeTestCases returns one instruction for every documented encoding, primary and CB-prefixed.
+func allOpCodeTestCases() []opCodeTestCase {
+	registers := []string{"B", "C", "D", "E", "H", "L", "[HL]", "A"}
+	registerPairs := []string{"BC", "DE", "HL", "SP"}
+	registerPairs2 := []string{"BC", "DE", "HL", "AF"}
+	conditionCodes := []string{"NZ", "Z", "NC", "C"}
+	alu := []string{"ADD", "ADC", "SUB", "SBC", "AND", "XOR", "OR", "CP"}
+	rot := []string{"RLC", "RRC", "RL", "RR", "SLA", "SRA", "SWAP", "SRL"}
+
+	cases := []opCodeTestCase{
+		{Instruction{"NOP", []string{}}, []byte{0x00}},
+		{Instruction{"LD", []string{"[BC]", "A"}}, []byte{0x02}},
+		{Instruction{"RLCA", []string{}}, []byte{0x07}},
+		{Instruction{"LD", []string{"[1234]", "SP"}}, []byte{0x08, 0xD2, 0x04}},
+		{Instruction{"LD", []string{"A", "[BC]"}}, []byte{0x0A}},
+		{Instruction{"RRCA", []string{}}, []byte{0x0F}},
+		{Instruction{"STOP", []string{}}, []byte{0x10, 0x00}},
+		{Instruction{"LD", []string{"[DE]", "A"}}, []byte{0x12}},
+		{Instruction{"RLA", []string{}}, []byte{0x17}},
+		{Instruction{"JR", []string{"2"}}, []byte{0x18, 0x00}},
+		{Instruction{"LD", []string{"A", "[DE]"}}, []byte{0x1A}},
+		{Instruction{"RRA", []string{}}, []byte{0x1F}},
+		{Instruction{"LDI", []string{"[HL]", "A"}}, []byte{0x22}},
+		{Instruction{"DAA", []string{}}, []byte{0x27}},
+		{Instruction{"LDI", []string{"A", "[HL]"}}, []byte{0x2A}},
+		{Instruction{"CPL", []string{}}, []byte{0x2F}},
+		{Instruction{"LDD", []string{"[HL]", "A"}}, []byte{0x32}},
+		{Instruction{"SCF", []string{}}, []byte{0x37}},
+		{Instruction{"LDD", []string{"A", "[HL]"}}, []byte{0x3A}},
+		{Instruction{"CCF", []string{}}, []byte{0x3F}},
+		{Instruction{"HALT", []string{}}, []byte{0x76}},
+		{Instruction{"RET", []string{}}, []byte{0xC9}},
+		{Instruction{"JP", []string{"1234"}}, []byte{0xC3, 0xD2, 0x04}},
+		{Instruction{"CALL", []string{"1234"}}, []byte{0xCD, 0xD2, 0x04}},
+		{Instruction{"RETI", []string{}}, []byte{0xD9}},
+		{Instruction{"LDH", []string{"[66]", "A"}}, []byte{0xE0, 0x42}},
+		{Instruction{"LD", []string{"[C]", "A"}}, []byte{0xE2}},
+		{Instruction{"ADD", []string{"SP", "66"}}, []byte{0xE8, 0x42}},
+		{Instruction{"JP", []string{"HL"}}, []byte{0xE9}},
+		{Instruction{"LD", []string{"[1234]", "A"}}, []byte{0xEA, 0xD2, 0x04}},
+		{Instruction{"LDH", []string{"A", "[66]"}}, []byte{0xF0, 0x42}},
+		{Instruction{"LD", []string{"A", "[C]"}}, []byte{0xF2}},
+		{Instruction{"DI", []string{}}, []byte{0xF3}},
+		{Instruction{"LD", []string{"HL", "SP+66"}}, []byte{0xF8, 0x42}},
+		{Instruction{"LD", []string{"SP", "HL"}}, []byte{0xF9}},
+		{Instruction{"LD", []string{"A", "[1234]"}}, []byte{0xFA, 0xD2, 0x04}},
+		{Instruction{"EI", []string{}}, []byte{0xFB}},
+	}
+
+	for y, register := range registers {
+		cases = append(cases,
+			opCodeTestCase{Instruction{"INC", []string{register}}, []byte{byte(0x04 + y*8)}},
+			opCodeTestCase{Instruction{"DEC", []string{register}}, []byte{byte(0x05 + y*8)}},
+			opCodeTestCase{Instruction{"LD", []string{register, "66"}}, []byte{byte(0x06 + y*8), 0x42}},
+			opCodeTestCase{Instruction{alu[y], []string{"A", "66"}}, []byte{byte(0xC6 + y*8), 0x42}},
+		)
+		for z, source := range registers {
+			if register != "[HL]" || source != "[HL]" {
+				// that one would be HALT
+				cases = append(cases, opCodeTestCase{Instruction{"LD", []string{register, source}}, []byte{byte(0x40 + y*8 + z)}})
+			}
+			cases = append(cases,
+				opCodeTestCase{Instruction{alu[y], []string{"A", source}}, []byte{byte(0x80 + y*8 + z)}},
+				opCodeTestCase{Instruction{rot[y], []string{source}}, []byte{0xCB, byte(y*8 + z)}},
+				opCodeTestCase{Instruction{"BIT", []string{strconv.Itoa(y), source}}, []byte{0xCB, byte(0x40 + y*8 + z)}},
+				opCodeTestCase{Instruction{"RES", []string{strconv.Itoa(y), source}}, []byte{0xCB, byte(0x80 + y*8 + z)}},
+				opCodeTestCase{Instruction{"SET", []string{strconv.Itoa(y), source}}, []byte{0xCB, byte(0xC0 + y*8 + z)}},
+			)
+		}
+		cases = append(cases, opCodeTestCase{Instruction{"RST", []string{strconv.Itoa(y * 8)}}, []byte{byte(0xC7 + y*8)}})
+	}
+
+	for p, registerPair := range registerPairs {
+		cases = append(cases,
+			opCodeTestCase{Instruction{"LD", []string{registerPair, "1234"}}, []byte{byte(0x01 + p*16), 0xD2, 0x04}},
+			opCodeTestCase{Instruction{"INC", []string{registerPair}}, []byte{byte(0x03 + p*16)}},
+			opCodeTestCase{Instruction{"ADD", []string{"HL", registerPair}}, []byte{byte(0x09 + p*16)}},
+			opCodeTestCase{Instruction{"DEC", []string{registerPair}}, []byte{byte(0x0B + p*16)}},
+		)
+	}
+	for p, registerPair := range registerPairs2 {
+		cases = append(cases,
+			opCodeTestCase{Instruction{"POP", []string{registerPair}}, []byte{byte(0xC1 + p*16)}},
+			opCodeTestCase{Instruction{"PUSH", []string{registerPair}}, []byte{byte(0xC5 + p*16)}},
+		)
+	}
+	for y, conditionCode := range conditionCodes {
+		cases = append(cases,
+			opCodeTestCase{Instruction{"JR", []string{conditionCode, "2"}}, []byte{byte(0x20 + y*8), 0x00}},
+			opCodeTestCase{Instruction{"RET", []string{conditionCode}}, []byte{byte(0xC0 + y*8)}},
+			opCodeTestCase{Instruction{"JP", []string{conditionCode, "1234"}}, []byte{byte(0xC2 + y*8), 0xD2, 0x04}},
+			opCodeTestCase{Instruction{"CALL", []string{conditionCode, "1234"}}, []byte{byte(0xC4 + y*8), 0xD2, 0x04}},
+		)
+	}
+
+	return cases
+}
+
+func TestAllOpCodes(t *testing.T) {
+	primary := map[byte]bool{}
+	prefixed := map[byte]bool{}
+	for _, testCase := range allOpCodeTestCases() {
+		tryTestInput(t, testCase.instruction, testCase.expectedOutput)
+		if testCase.expectedOutput[0] == 0xCB {
+			prefixed[testCase.expectedOutput[1]] = true
+		} else {
+			primary[testCase.expectedOutput[0]] = true
+		}
+	}
+
+	// 256 opcodes, minus the 0xCB prefix and the 11 unused ones
+	if len(primary) != 244 {
+		t.Errorf("Covered %d primary opcodes, should have been 244", len(primary))
+	}
+	if len(prefixed) != 256 {
+		t.Errorf("Covered %d CB-prefixed opcodes, should have been 256", len(prefixed))
+	}
+}
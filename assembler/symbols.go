@@ -0,0 +1,43 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+// Symbols_Write writes the given labels in the bank:address format that most debuggers can read.
+// Local labels are written with their full names, like "parent.loop".
+func Symbols_Write(writer io.Writer, labels map[string]rom.Label) error {
+	if _, err := fmt.Fprintln(writer, "; generated by gbasm"); err != nil {
+		return err
+	}
+	for _, name := range Symbols_SortLabelNames(labels) {
+		label := labels[name]
+		if _, err := fmt.Fprintf(writer, "%02x:%04x %s\n", label.Bank, label.Address, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Symbols_SortLabelNames returns the names of the given labels, sorted by bank and then address.
+func Symbols_SortLabelNames(labels map[string]rom.Label) []string {
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		first, second := labels[names[i]], labels[names[j]]
+		if first.Bank != second.Bank {
+			return first.Bank < second.Bank
+		}
+		if first.Address != second.Address {
+			return first.Address < second.Address
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,36 @@
+package assembler
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func TestSymbols(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.s": &fstest.MapFile{Data: []byte("start:\n\tnop\n.loop:\n\tjr .loop\nalso:\nbefore:\n\tret\n.bank 2\nfar:\n\tret\n.section \"vars\", WRAM0\nwFrame: ds 1\n")},
+	}
+	result, err := Assemble(fsys, "main.s", Options{Info: &rom.Info{Name: "TEST", MBC: "MBC1", ROMSize: 64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := Symbols_Write(&buffer, result.Labels); err != nil {
+		t.Fatal(err)
+	}
+
+	// labels at the same address are sorted by name
+	expected := "; generated by gbasm\n" +
+		"00:0150 start\n" +
+		"00:0151 start.loop\n" +
+		"00:0153 also\n" +
+		"00:0153 before\n" +
+		"00:c000 wFrame\n" +
+		"02:4000 far\n"
+	if buffer.String() != expected {
+		t.Errorf("Symbol file was\n%s\nshould have been\n%s", buffer.String(), expected)
+	}
+}
@@ -0,0 +1,116 @@
+package diagnostics
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Severity is how bad a diagnostic is.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// A Diagnostic is an error or warning about a specific place in the source code.
+// Line and Column are 0 if they aren't known.
+type Diagnostic struct {
+	Severity Severity
+	File     string
+	Line     int
+	Column   int
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Line != 0 {
+		location += ":" + strconv.Itoa(d.Line)
+		if d.Column != 0 {
+			location += ":" + strconv.Itoa(d.Column)
+		}
+	}
+	if location == "" {
+		return d.Severity.String() + ": " + d.Message
+	}
+	return location + ": " + d.Severity.String() + ": " + d.Message
+}
+
+// Current contains every diagnostic that's been reported so far, in order.
+var Current []Diagnostic
+
+// abort is what Fatalf panics with, so that Try can tell it apart from other panics.
+type abort struct{}
+
+// Reset forgets about all diagnostics that have been reported.
+func Reset() {
+	Current = []Diagnostic{}
+}
+
+// Report adds the given diagnostic, unless the same one has already been reported.
+// That happens when a line is looked at more than once, like while finding labels and then assembling.
+func Report(diagnostic Diagnostic) {
+	for _, existing := range Current {
+		if existing.Severity == diagnostic.Severity && existing.File == diagnostic.File && existing.Line == diagnostic.Line && existing.Message == diagnostic.Message {
+			return
+		}
+	}
+	Current = append(Current, diagnostic)
+}
+
+// Errorf reports an error, but lets things keep going.
+func Errorf(file string, line int, format string, a ...interface{}) {
+	Report(Diagnostic{Error, file, line, 0, fmt.Sprintf(format, a...)})
+}
+
+// Warningf reports a warning.
+func Warningf(file string, line int, format string, a ...interface{}) {
+	Report(Diagnostic{Warning, file, line, 0, fmt.Sprintf(format, a...)})
+}
+
+// Fatalf reports an error, and stops whatever is being done until the closest Try.
+func Fatalf(file string, line int, format string, a ...interface{}) {
+	Errorf(file, line, format, a...)
+	panic(abort{})
+}
+
+// Try runs f, returning false if it was stopped by Fatalf.
+// Any diagnostics that f reports for the given line, without a column, get the given column.
+func Try(file string, line int, column int, f func()) (ok bool) {
+	start := len(Current)
+	defer func() {
+		for i := start; i < len(Current); i++ {
+			if Current[i].File == file && Current[i].Line == line && Current[i].Column == 0 {
+				Current[i].Column = column
+			}
+		}
+
+		if r := recover(); r != nil {
+			if _, isAbort := r.(abort); !isAbort {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+
+	f()
+	return true
+}
+
+// HasErrors returns true if any errors (not warnings) have been reported.
+func HasErrors() bool {
+	for _, diagnostic := range Current {
+		if diagnostic.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
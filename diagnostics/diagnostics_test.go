@@ -0,0 +1,41 @@
+package diagnostics
+
+import "testing"
+
+func TestTry(t *testing.T) {
+	Reset()
+
+	ok := Try("test.s", 3, 5, func() {
+		Warningf("test.s", 3, "first %d", 1)
+		Fatalf("test.s", 3, "second")
+		Errorf("test.s", 3, "never reported")
+	})
+	if ok {
+		t.Error("Try returned true after Fatalf")
+	}
+
+	ok = Try("test.s", 4, 1, func() {
+		Errorf("other.s", 10, "third")
+		Errorf("other.s", 10, "third")
+	})
+	if !ok {
+		t.Error("Try returned false without Fatalf")
+	}
+
+	expected := []string{
+		"test.s:3:5: warning: first 1",
+		"test.s:3:5: error: second",
+		"other.s:10: error: third",
+	}
+	if len(Current) != len(expected) {
+		t.Fatalf("Got %d diagnostics, should have been %d", len(Current), len(expected))
+	}
+	for i, diagnostic := range Current {
+		if diagnostic.String() != expected[i] {
+			t.Errorf("Diagnostic %d was '%s', should have been '%s'", i, diagnostic.String(), expected[i])
+		}
+	}
+	if !HasErrors() {
+		t.Error("HasErrors returned false")
+	}
+}
@@ -0,0 +1,154 @@
+package gfx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// TileSize is the width and height of a tile, in pixels.
+const TileSize = 8
+
+// Options controls how an image is turned into tiles.
+type Options struct {
+	BitDepth    int   // 1 or 2 bits per pixel, defaults to 2
+	Palette     []int // the color that each shade becomes, defaults to keeping them the same
+	Tall        bool  // if true, tiles are ordered for 8x16 sprites, with each tile followed by the one below it
+	Deduplicate bool  // if true, tiles that are the same are only output once
+}
+
+// Graphics is the result of converting an image.
+type Graphics struct {
+	Tiles   []byte
+	Tilemap []int // the index of the tile that goes in each spot of the image, left to right and top to bottom
+}
+
+// TilemapBytes returns the tilemap with one byte for each tile, which only works if there are at most 256 tiles.
+func (g Graphics) TilemapBytes() ([]byte, error) {
+	output := []byte{}
+	for _, index := range g.Tilemap {
+		if index > 255 {
+			return nil, errors.New("Image has too many tiles for a tilemap (more than 256)")
+		}
+		output = append(output, byte(index))
+	}
+	return output, nil
+}
+
+// Convert turns the given image into tile data.
+// Paletted images use the index of each pixel's color as its shade, anything else is converted to grayscale, with white being 0.
+func Convert(img image.Image, options Options) (Graphics, error) {
+	if options.BitDepth == 0 {
+		options.BitDepth = 2
+	}
+	if options.BitDepth != 1 && options.BitDepth != 2 {
+		return Graphics{}, fmt.Errorf("Bit depth must be 1 or 2, not %d", options.BitDepth)
+	}
+	colorCount := 1 << uint(options.BitDepth)
+	if options.Palette == nil {
+		options.Palette = make([]int, colorCount)
+		for i := range options.Palette {
+			options.Palette[i] = i
+		}
+	}
+	if len(options.Palette) != colorCount {
+		return Graphics{}, fmt.Errorf("Palette must have %d colors, not %d", colorCount, len(options.Palette))
+	}
+	for _, shade := range options.Palette {
+		if shade < 0 || shade >= colorCount {
+			return Graphics{}, fmt.Errorf("Palette color %d doesn't fit in %d bits", shade, options.BitDepth)
+		}
+	}
+
+	// a unit is one tile, or two for 8x16 sprites
+	unitHeight := TileSize
+	if options.Tall {
+		unitHeight = 2 * TileSize
+	}
+	bounds := img.Bounds()
+	if bounds.Dx()%TileSize != 0 || bounds.Dy()%unitHeight != 0 {
+		return Graphics{}, fmt.Errorf("Image size %dx%d is not a multiple of %dx%d", bounds.Dx(), bounds.Dy(), TileSize, unitHeight)
+	}
+
+	result := Graphics{Tiles: []byte{}, Tilemap: []int{}}
+	unitCount := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += unitHeight {
+		for x := bounds.Min.X; x < bounds.Max.X; x += TileSize {
+			unit := []byte{}
+			for tileY := y; tileY < y+unitHeight; tileY += TileSize {
+				tile, err := convertTile(img, x, tileY, options)
+				if err != nil {
+					return Graphics{}, err
+				}
+				unit = append(unit, tile...)
+			}
+
+			index := -1
+			if options.Deduplicate {
+				index = findUnit(result.Tiles, unit)
+			}
+			if index == -1 {
+				index = unitCount
+				result.Tiles = append(result.Tiles, unit...)
+				unitCount++
+			}
+
+			// the tilemap points to the first tile of each unit
+			result.Tilemap = append(result.Tilemap, index*unitHeight/TileSize)
+		}
+	}
+	return result, nil
+}
+
+// convertTile returns the data for the 8x8 tile with its top left corner at the given coordinates.
+func convertTile(img image.Image, x int, y int, options Options) ([]byte, error) {
+	output := []byte{}
+	for row := y; row < y+TileSize; row++ {
+		// each bit of a pixel's shade goes into its own byte, with the leftmost pixel in the highest bit
+		planes := make([]byte, options.BitDepth)
+		for column := x; column < x+TileSize; column++ {
+			shade, err := getShade(img, column, row, options.BitDepth)
+			if err != nil {
+				return nil, err
+			}
+			shade = options.Palette[shade]
+			for plane := range planes {
+				planes[plane] = planes[plane]<<1 | byte((shade>>uint(plane))&1)
+			}
+		}
+		output = append(output, planes...)
+	}
+	return output, nil
+}
+
+// getShade returns the shade of the pixel at the given coordinates, from 0 up to one less than the number of colors.
+func getShade(img image.Image, x int, y int, bitDepth int) (int, error) {
+	colorCount := 1 << uint(bitDepth)
+	if paletted, isPaletted := img.(*image.Paletted); isPaletted {
+		index := int(paletted.ColorIndexAt(x, y))
+		if index >= colorCount {
+			return 0, fmt.Errorf("Color %d of the palette at (%d, %d) doesn't fit in %d bits", index, x, y, bitDepth)
+		}
+		return index, nil
+	}
+
+	_, _, _, alpha := img.At(x, y).RGBA()
+	if alpha == 0 {
+		// transparent pixels are treated as the lightest shade
+		return 0, nil
+	}
+	gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+	return colorCount - 1 - int(gray.Y)*colorCount/256, nil
+}
+
+// findUnit returns the index of the given unit of tiles in the data, or -1 if it isn't there.
+func findUnit(data []byte, unit []byte) int {
+	for i := 0; i+len(unit) <= len(data); i += len(unit) {
+		if bytes.Equal(data[i:i+len(unit)], unit) {
+			return i / len(unit)
+		}
+	}
+	return -1
+}
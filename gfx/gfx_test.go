@@ -0,0 +1,189 @@
+package gfx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+var testPalette = color.Palette{
+	color.Gray{0xFF},
+	color.Gray{0xAA},
+	color.Gray{0x55},
+	color.Gray{0x00},
+	color.Gray{0x80},
+}
+
+// newTestImage creates a paletted image, with the color index of each pixel given by the shade function
+func newTestImage(width int, height int, shade func(x int, y int) int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), testPalette)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetColorIndex(x, y, uint8(shade(x, y)))
+		}
+	}
+	return img
+}
+
+func TestConvert(t *testing.T) {
+	// every row is 0, 1, 2, 3, 0, 1, 2, 3
+	img := newTestImage(8, 8, func(x int, y int) int { return x % 4 })
+	expected := bytes.Repeat([]byte{0x55, 0x33}, 8)
+
+	graphics, err := Convert(img, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(graphics.Tiles, expected) {
+		t.Errorf("Tiles were % X, should have been % X", graphics.Tiles, expected)
+	}
+	if !equalInts(graphics.Tilemap, []int{0}) {
+		t.Errorf("Tilemap was % X", graphics.Tilemap)
+	}
+
+	// the same thing in grayscale should come out the same
+	gray := image.NewGray(img.Bounds())
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			gray.Set(x, y, img.At(x, y))
+		}
+	}
+	graphics, err = Convert(gray, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(graphics.Tiles, expected) {
+		t.Errorf("Grayscale tiles were % X, should have been % X", graphics.Tiles, expected)
+	}
+
+	// swapping the shades around swaps the planes
+	graphics, err = Convert(img, Options{Palette: []int{0, 2, 1, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := bytes.Repeat([]byte{0x33, 0x55}, 8); !bytes.Equal(graphics.Tiles, expected) {
+		t.Errorf("Tiles with palette were % X, should have been % X", graphics.Tiles, expected)
+	}
+
+	// 1bpp only has one plane
+	img = newTestImage(8, 8, func(x int, y int) int { return x % 2 })
+	graphics, err = Convert(img, Options{BitDepth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := bytes.Repeat([]byte{0x55}, 8); !bytes.Equal(graphics.Tiles, expected) {
+		t.Errorf("1bpp tiles were % X, should have been % X", graphics.Tiles, expected)
+	}
+}
+
+func TestConvertOrder(t *testing.T) {
+	// every tile is filled with its own number, going left to right and then top to bottom
+	img := newTestImage(16, 16, func(x int, y int) int { return (y/8)*2 + x/8 })
+	tile := func(shade int) []byte {
+		return bytes.Repeat([]byte{byte(0xFF * (shade & 1)), byte(0xFF * (shade >> 1))}, 8)
+	}
+
+	graphics, err := Convert(img, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bytes.Join([][]byte{tile(0), tile(1), tile(2), tile(3)}, nil)
+	if !bytes.Equal(graphics.Tiles, expected) {
+		t.Errorf("Tiles were % X, should have been % X", graphics.Tiles, expected)
+	}
+	if !equalInts(graphics.Tilemap, []int{0, 1, 2, 3}) {
+		t.Errorf("Tilemap was % X", graphics.Tilemap)
+	}
+
+	// 8x16 sprites have the tile below right after the one above
+	graphics, err = Convert(img, Options{Tall: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = bytes.Join([][]byte{tile(0), tile(2), tile(1), tile(3)}, nil)
+	if !bytes.Equal(graphics.Tiles, expected) {
+		t.Errorf("8x16 tiles were % X, should have been % X", graphics.Tiles, expected)
+	}
+	if !equalInts(graphics.Tilemap, []int{0, 2}) {
+		t.Errorf("8x16 tilemap was % X", graphics.Tilemap)
+	}
+}
+
+func TestConvertDeduplicate(t *testing.T) {
+	// the first two tiles are the same, the third is different
+	img := newTestImage(24, 8, func(x int, y int) int { return x / 16 })
+
+	graphics, err := Convert(img, Options{Deduplicate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphics.Tiles) != 32 {
+		t.Errorf("Got %d bytes of tiles, should have been 32", len(graphics.Tiles))
+	}
+	if !equalInts(graphics.Tilemap, []int{0, 0, 1}) {
+		t.Errorf("Tilemap was % X", graphics.Tilemap)
+	}
+
+	graphics, err = Convert(img, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphics.Tiles) != 48 || !equalInts(graphics.Tilemap, []int{0, 1, 2}) {
+		t.Errorf("Without deduplication, got %d bytes of tiles and tilemap % X", len(graphics.Tiles), graphics.Tilemap)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := map[string]struct {
+		img     image.Image
+		options Options
+	}{
+		"odd size":        {newTestImage(12, 8, func(x int, y int) int { return 0 }), Options{}},
+		"8x16 odd height": {newTestImage(8, 8, func(x int, y int) int { return 0 }), Options{Tall: true}},
+		"color too big":   {newTestImage(8, 8, func(x int, y int) int { return 4 }), Options{}},
+		"1bpp color":      {newTestImage(8, 8, func(x int, y int) int { return 2 }), Options{BitDepth: 1}},
+		"bad bit depth":   {newTestImage(8, 8, func(x int, y int) int { return 0 }), Options{BitDepth: 3}},
+		"short palette":   {newTestImage(8, 8, func(x int, y int) int { return 0 }), Options{Palette: []int{0, 1}}},
+		"palette too big": {newTestImage(8, 8, func(x int, y int) int { return 0 }), Options{Palette: []int{0, 1, 2, 4}}},
+	}
+	for name, test := range tests {
+		if _, err := Convert(test.img, test.options); err == nil {
+			t.Errorf("Converting with %s should have failed", name)
+		}
+	}
+}
+
+func TestTilemapBytes(t *testing.T) {
+	graphics, err := Convert(image.NewGray(image.Rect(0, 0, 8, 8*257)), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := graphics.TilemapBytes(); err == nil {
+		t.Errorf("Tilemap with 257 tiles should have failed")
+	}
+
+	graphics, err = Convert(image.NewGray(image.Rect(0, 0, 8, 8*257)), Options{Deduplicate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tilemap, err := graphics.TilemapBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tilemap, make([]byte, 257)) {
+		t.Errorf("Deduplicated tilemap was % X", tilemap)
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,21 +1,52 @@
 package main
 
 import (
+	"bufio"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
-	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/thatoddmailbox/gbasm/assembler"
+	"github.com/thatoddmailbox/gbasm/diagnostics"
+	"github.com/thatoddmailbox/gbasm/object"
 	"github.com/thatoddmailbox/gbasm/rom"
-	"github.com/thatoddmailbox/gbasm/utils"
 )
 
 func main() {
 	log.Println("gbasm")
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "asm":
+			assembleCommand(os.Args[2:])
+			return
+
+		case "link":
+			linkCommand(os.Args[2:])
+			return
+
+		case "disasm":
+			disassembleCommand(os.Args[2:])
+			return
+
+		case "fix":
+			fixCommand(os.Args[2:])
+			return
+		}
+	}
+
 	outputFileName := flag.String("output", "out.gb", "The path and name of the output file.")
+	symbolFileName := flag.String("sym", "", "The path and name of a symbol file to write, for debuggers like BGB, SameBoy, and Emulicious.")
+	listingFileName := flag.String("listing", "", "The path and name of a listing file to write, with the address and output of every line.")
+	includeDirs := stringList{}
+	flag.Var(&includeDirs, "I", "A folder to look for included files in, if they aren't next to the file including them. Can be used more than once.")
+	dependencyFileName := flag.String("M", "", "The path and name of a dependency file to write, with the files that the ROM was made from, for make and other build tools.")
 
 	flag.Parse()
 
@@ -24,43 +55,434 @@ func main() {
 		panic(err)
 	}
 
-	ReadConfigFile(workingDirectory)
+	info, err := assembler.ReadConfigFile(os.DirFS(workingDirectory))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// the include paths in info.toml are relative to the working directory, which might not be the root of the file system
+	fsys, root, entry, includePaths := openFileSystem("main.s", append(includeDirs, info.IncludePaths...))
+	info.IncludePaths = nil
+
+	log.Println("Parsing file main.s...")
+	result, err := assembler.Assemble(fsys, entry, assembler.Options{Info: &info, IncludePaths: includePaths})
+	checkResult(result, err)
+
+	writeOutputFiles(result, *outputFileName, *symbolFileName, *listingFileName)
+	if *dependencyFileName != "" {
+		writeDependencyFile(*dependencyFileName, *outputFileName, append(getFilePaths(root, result.Dependencies), "info.toml"))
+	}
+}
+
+// assembleCommand assembles one source file into an object file, to be linked later.
+func assembleCommand(args []string) {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	outputFileName := flags.String("output", "", "The path and name of the output file. Defaults to the input file, with a .o extension.")
+	includeDirs := stringList{}
+	flags.Var(&includeDirs, "I", "A folder to look for included files in, if they aren't next to the file including them. Can be used more than once.")
+	dependencyFileName := flags.String("M", "", "The path and name of a dependency file to write, with the files that the object was made from, for make and other build tools.")
+	flags.Parse(args)
 
-	rom.ValidateParameters()
-	rom.Initialize()
+	if flags.NArg() != 1 {
+		log.Fatalln("Usage: gbasm asm [-output file.o] [-I folder] [-M file.d] file.s")
+	}
+	inputFileName := flags.Arg(0)
+	if *outputFileName == "" {
+		*outputFileName = strings.TrimSuffix(inputFileName, filepath.Ext(inputFileName)) + ".o"
+	}
 
-	// output the actual data
-	Assembler_ParseFile(path.Join(workingDirectory, "main.s"), 0x150, 32*utils.KiB)
+	fsys, root, entry, includePaths := openFileSystem(inputFileName, includeDirs)
 
-	rom.Finalize()
+	log.Printf("Parsing file %s...\n", filepath.Base(inputFileName))
+	result, resultDiagnostics, err := assembler.AssembleObject(fsys, entry, assembler.Options{IncludePaths: includePaths})
+	printDiagnostics(resultDiagnostics)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	// output the actual file
-	outputFile, err := os.OpenFile(*outputFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	outputFile, err := os.OpenFile(*outputFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		panic(err)
 	}
 	defer outputFile.Close()
-	_, err = outputFile.Write(rom.Current.Output[:])
+	if err = object.Write(outputFile, result); err != nil {
+		panic(err)
+	}
+
+	if *dependencyFileName != "" {
+		writeDependencyFile(*dependencyFileName, *outputFileName, getFilePaths(root, result.Dependencies))
+	}
+}
+
+// linkCommand links object files together into a ROM, using the info.toml in the working directory.
+func linkCommand(args []string) {
+	flags := flag.NewFlagSet("link", flag.ExitOnError)
+	outputFileName := flags.String("output", "out.gb", "The path and name of the output file.")
+	symbolFileName := flags.String("sym", "", "The path and name of a symbol file to write, for debuggers like BGB, SameBoy, and Emulicious.")
+	listingFileName := flags.String("listing", "", "The path and name of a listing file to write, with the address and output of every line.")
+	dependencyFileName := flags.String("M", "", "The path and name of a dependency file to write, with the object files and info.toml, for make and other build tools.")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		log.Fatalln("Usage: gbasm link [-output out.gb] [-sym out.sym] [-listing out.lst] [-M out.d] file.o...")
+	}
+
+	workingDirectory, err := os.Getwd()
 	if err != nil {
 		panic(err)
 	}
 
+	info, err := assembler.ReadConfigFile(os.DirFS(workingDirectory))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	objects := []*object.Object{}
+	for _, inputFileName := range flags.Args() {
+		inputFile, err := os.Open(inputFileName)
+		if err != nil {
+			log.Fatalf("Couldn't open object file %s: %s", inputFileName, err)
+		}
+		inputObject, err := object.Read(inputFile)
+		inputFile.Close()
+		if err != nil {
+			log.Fatalf("Couldn't read object file %s: %s", inputFileName, err)
+		}
+		objects = append(objects, inputObject)
+	}
+
+	result, err := assembler.Link(objects, assembler.Options{Info: &info})
+	checkResult(result, err)
+
+	writeOutputFiles(result, *outputFileName, *symbolFileName, *listingFileName)
+	if *dependencyFileName != "" {
+		writeDependencyFile(*dependencyFileName, *outputFileName, append(flags.Args(), "info.toml"))
+	}
+}
+
+// disassembleCommand writes the disassembly of a ROM, as source code that can be assembled again.
+func disassembleCommand(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	outputFileName := flags.String("output", "", "The path and name of the output file. Defaults to printing the disassembly.")
+	symbolFileName := flags.String("sym", "", "The path and name of a symbol file, with labels to put in the disassembly.")
+	hintFileName := flags.String("hints", "", "The path and name of a file with 'code bank:start bank:end' or 'data bank:start bank:end' lines, to mark which parts of the ROM are data.")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalln("Usage: gbasm disasm [-output out.s] [-sym rom.sym] [-hints rom.hints] rom.gb")
+	}
+
+	romData, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Couldn't read ROM %s: %s", flags.Arg(0), err)
+	}
+
+	options := assembler.DisassemblyOptions{}
+	if *symbolFileName != "" {
+		symbolFile, err := os.Open(*symbolFileName)
+		if err != nil {
+			log.Fatalf("Couldn't open symbol file %s: %s", *symbolFileName, err)
+		}
+		options.Labels, err = assembler.Disassembler_ReadSymbolFile(symbolFile)
+		symbolFile.Close()
+		if err != nil {
+			log.Fatalf("Couldn't read symbol file %s: %s", *symbolFileName, err)
+		}
+	}
+	if *hintFileName != "" {
+		hintFile, err := os.Open(*hintFileName)
+		if err != nil {
+			log.Fatalf("Couldn't open hint file %s: %s", *hintFileName, err)
+		}
+		options.Hints, err = assembler.Disassembler_ReadHintFile(hintFile)
+		hintFile.Close()
+		if err != nil {
+			log.Fatalf("Couldn't read hint file %s: %s", *hintFileName, err)
+		}
+	}
+
+	outputFile := os.Stdout
+	if *outputFileName != "" {
+		outputFile, err = os.OpenFile(*outputFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer outputFile.Close()
+	}
+
+	if err = assembler.Disassembler_Write(outputFile, romData, options); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// fixCommand repairs the header and checksums of an existing ROM.
+func fixCommand(args []string) {
+	flags := flag.NewFlagSet("fix", flag.ExitOnError)
+	outputFileName := flags.String("output", "", "The path and name of the output file. Defaults to changing the ROM in place.")
+	title := flags.String("title", "", "A new title for the ROM.")
+	fixLogo := flags.Bool("logo", false, "Puts back the logo that the Gameboy checks for when it starts.")
+	cartridgeType := flags.String("type", "", "A new cartridge type, as a number, like 0x1B for MBC5+RAM+BATTERY.")
+	padValue := flags.String("pad", "", "Pads the ROM to a valid size with the given byte, like 0xFF, and sets the ROM size in the header to match.")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalln("Usage: gbasm fix [-output out.gb] [-title TITLE] [-logo] [-type 0x1B] [-pad 0xFF] rom.gb")
+	}
+	inputFileName := flags.Arg(0)
+	if *outputFileName == "" {
+		*outputFileName = inputFileName
+	}
+
+	options := rom.FixOptions{Title: *title, FixLogo: *fixLogo}
+	if *cartridgeType != "" {
+		value, err := strconv.ParseUint(*cartridgeType, 0, 8)
+		if err != nil {
+			log.Fatalf("Cartridge type must be a byte, got '%s'", *cartridgeType)
+		}
+		typeByte := byte(value)
+		options.CartridgeType = &typeByte
+	}
+	if *padValue != "" {
+		value, err := strconv.ParseUint(*padValue, 0, 8)
+		if err != nil {
+			log.Fatalf("Pad value must be a byte, got '%s'", *padValue)
+		}
+		options.Pad = true
+		options.PadValue = byte(value)
+	}
+
+	romData, err := os.ReadFile(inputFileName)
+	if err != nil {
+		log.Fatalf("Couldn't read ROM %s: %s", inputFileName, err)
+	}
+
+	fixed, changes, err := rom.Fix(romData, options)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(changes) == 0 {
+		log.Println("Nothing needed to be fixed")
+	}
+	for _, change := range changes {
+		log.Println(change)
+	}
+
+	if err = os.WriteFile(*outputFileName, fixed, 0644); err != nil {
+		panic(err)
+	}
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// openFileSystem opens a file system with the given file and folders in it, and returns the folder it's in and their paths in it.
+// That's usually just the folder with the file, but it goes further up if some of the other folders aren't in there.
+func openFileSystem(fileName string, dirs []string) (fs.FS, string, string, []string) {
+	absoluteFileName, err := filepath.Abs(fileName)
+	if err != nil {
+		panic(err)
+	}
+
+	root := filepath.Dir(absoluteFileName)
+	absoluteDirs := []string{}
+	for _, dir := range dirs {
+		absoluteDir, err := filepath.Abs(filepath.FromSlash(dir))
+		if err != nil {
+			panic(err)
+		}
+		absoluteDirs = append(absoluteDirs, absoluteDir)
+
+		for {
+			relativeDir, err := filepath.Rel(root, absoluteDir)
+			if err == nil && relativeDir != ".." && !strings.HasPrefix(relativeDir, ".."+string(filepath.Separator)) {
+				break
+			}
+			if filepath.Dir(root) == root {
+				log.Fatalf("Include folder %s has to be on the same drive as %s", dir, fileName)
+			}
+			root = filepath.Dir(root)
+		}
+	}
+
+	getPath := func(absolutePath string) string {
+		relativePath, err := filepath.Rel(root, absolutePath)
+		if err != nil {
+			panic(err)
+		}
+		return filepath.ToSlash(relativePath)
+	}
+	includePaths := []string{}
+	for _, absoluteDir := range absoluteDirs {
+		includePaths = append(includePaths, getPath(absoluteDir))
+	}
+	return os.DirFS(root), root, getPath(absoluteFileName), includePaths
+}
+
+// getFilePaths turns paths in the file system from openFileSystem into paths that are relative to the working directory.
+func getFilePaths(root string, paths []string) []string {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+
+	result := []string{}
+	for _, fileSystemPath := range paths {
+		filePath := filepath.Join(root, filepath.FromSlash(fileSystemPath))
+		if relativePath, err := filepath.Rel(workingDirectory, filePath); err == nil {
+			filePath = relativePath
+		}
+		result = append(result, filepath.ToSlash(filePath))
+	}
+	return result
+}
+
+// printDiagnostics logs the given errors and warnings.
+func printDiagnostics(diagnosticList []diagnostics.Diagnostic) {
+	for _, diagnostic := range diagnosticList {
+		log.Println(diagnostic)
+	}
+}
+
+// checkResult logs any errors and warnings from assembling or linking, and exits if it failed.
+func checkResult(result *assembler.Result, err error) {
+	if result != nil {
+		printDiagnostics(result.Diagnostics)
+	}
+
+	if _, isSourceError := err.(*assembler.Error); isSourceError {
+		log.Println("Stopping because of errors")
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// writeOutputFiles writes the ROM, and the symbol and listing files if they were asked for.
+func writeOutputFiles(result *assembler.Result, outputFileName string, symbolFileName string, listingFileName string) {
+	writeROM(result, outputFileName)
+	if symbolFileName != "" {
+		writeSymbolFile(result, symbolFileName)
+	}
+	if listingFileName != "" {
+		writeListingFile(result, listingFileName)
+	}
+}
+
+// writeROM writes the finished ROM to the given file, and logs some information about it.
+func writeROM(result *assembler.Result, outputFileName string) {
+	outputFile, err := os.OpenFile(outputFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		panic(err)
+	}
+	defer outputFile.Close()
+	_, err = outputFile.Write(result.ROM)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Println("Label listing:")
+
+	for _, name := range assembler.Symbols_SortLabelNames(result.Labels) {
+		label := result.Labels[name]
+		log.Printf(" * %s %02X:%04X", name, label.Bank, label.Address)
+	}
+
 	log.Println("Constant listing:")
 
-	definitionKeys := make([]string, len(rom.Current.Definitions))
-	i := 0
-	for name, _ := range rom.Current.Definitions {
-		definitionKeys[i] = name
-		i += 1
+	definitionKeys := []string{}
+	for name, _ := range result.Constants {
+		definitionKeys = append(definitionKeys, name)
 	}
 
 	sort.Strings(definitionKeys)
 
 	for _, name := range definitionKeys {
-		value := rom.Current.Definitions[name]
+		value := result.Constants[name]
 		log.Println(" *", name, value, "0x"+strconv.FormatInt(int64(value), 16))
 	}
 
 	log.Println()
-	log.Printf("Usage: %d out of %d bytes", rom.Current.UsedByteCount, len(rom.Current.Output))
+	log.Printf("Usage: %d out of %d bytes", result.UsedByteCount, len(result.ROM))
+
+	ramTypes := []string{}
+	for sectionType := range result.UsedRAMByteCounts {
+		ramTypes = append(ramTypes, sectionType)
+	}
+	sort.Strings(ramTypes)
+	for _, sectionType := range ramTypes {
+		log.Printf("%s usage: %d bytes", sectionType, result.UsedRAMByteCounts[sectionType])
+	}
+}
+
+// writeSymbolFile writes the labels to a file in the bank:address format that most debuggers can read.
+func writeSymbolFile(result *assembler.Result, symbolFileName string) {
+	symbolFile, err := os.OpenFile(symbolFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer symbolFile.Close()
+
+	writer := bufio.NewWriter(symbolFile)
+	if err = assembler.Symbols_Write(writer, result.Labels); err != nil {
+		panic(err)
+	}
+	if err = writer.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+// writeListingFile writes a listing of everything that went into the ROM.
+func writeListingFile(result *assembler.Result, listingFileName string) {
+	listingFile, err := os.OpenFile(listingFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer listingFile.Close()
+
+	writer := bufio.NewWriter(listingFile)
+	if err = assembler.Listing_Write(writer, result.ROM, result.Objects); err != nil {
+		panic(err)
+	}
+	if err = writer.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+// writeDependencyFile writes a makefile rule that says the target depends on the given files.
+// Every file also gets an empty rule, so that make doesn't stop if one of them is deleted.
+func writeDependencyFile(dependencyFileName string, target string, dependencies []string) {
+	dependencyFile, err := os.OpenFile(dependencyFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer dependencyFile.Close()
+
+	escapedDependencies := []string{}
+	for _, dependency := range dependencies {
+		escapedDependencies = append(escapedDependencies, escapeMakePath(dependency))
+	}
+
+	writer := bufio.NewWriter(dependencyFile)
+	fmt.Fprintf(writer, "%s: %s\n", escapeMakePath(filepath.ToSlash(target)), strings.Join(escapedDependencies, " "))
+	for _, dependency := range escapedDependencies {
+		fmt.Fprintf(writer, "\n%s:\n", dependency)
+	}
+	if err = writer.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+// escapeMakePath escapes the characters in a path that mean something else to make.
+func escapeMakePath(filePath string) string {
+	return strings.NewReplacer(" ", "\\ ", "#", "\\#", "$", "$$").Replace(filePath)
 }
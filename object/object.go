@@ -0,0 +1,148 @@
+package object
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+)
+
+// Unspecified is used for the bank or address of a section when the linker is free to pick it.
+const Unspecified = -1
+
+// SectionTypeInfo describes the area of memory that a type of section is placed in.
+type SectionTypeInfo struct {
+	Start     int // first address of the area
+	End       int // one past the last address of the area
+	IsBanked  bool
+	IsRAM     bool
+	FirstBank int // the lowest bank number, if the area is banked
+}
+
+// SectionTypes contains the types of sections that can be used.
+// RAM sections don't have any data, they just reserve space for variables.
+var SectionTypes = map[string]SectionTypeInfo{
+	"ROM0":  SectionTypeInfo{0x0000, 0x4000, false, false, 0},
+	"ROMX":  SectionTypeInfo{0x4000, 0x8000, true, false, 1},
+	"SRAM":  SectionTypeInfo{0xA000, 0xC000, true, true, 0},
+	"WRAM0": SectionTypeInfo{0xC000, 0xD000, false, true, 0},
+	"WRAMX": SectionTypeInfo{0xD000, 0xE000, true, true, 1},
+	"HRAM":  SectionTypeInfo{0xFF80, 0xFFFF, false, true, 0},
+}
+
+// A Symbol is a label that points somewhere in a section.
+type Symbol struct {
+	Name   string
+	Offset int
+	File   string
+	Line   int
+}
+
+// A Relocation is an instruction that refers to symbols, so it can only be assembled once the linker has placed everything.
+type Relocation struct {
+	Offset   int
+	Size     int
+	Mnemonic string
+	Operands []string
+	File     string
+	Line     int
+}
+
+// A Section is a block of code or data that is placed by the linker.
+type Section struct {
+	Name        string
+	Type        string
+	Bank        int
+	Address     int
+	Size        int
+	Data        []byte
+	Symbols     []Symbol
+	Relocations []Relocation
+	Align       int // the address of the section has to be a multiple of this, if it's more than 1
+	MaxSize     int // the section can't be bigger than this, if it's more than 0
+	File        string
+	Line        int
+}
+
+// An Assertion is a condition that refers to symbols, so it can only be checked once the linker has placed everything.
+type Assertion struct {
+	Expression string
+	Message    string
+	File       string
+	Line       int
+}
+
+// A ListingLine is a line of source code, along with where its output went.
+type ListingLine struct {
+	Section string // empty if the line isn't in a section
+	Offset  int
+	Size    int
+	File    string
+	Line    int
+	Text    string
+}
+
+// An Object is the result of assembling one source file.
+type Object struct {
+	Constants    map[string]int
+	Sections     []*Section
+	Assertions   []Assertion
+	Listing      []ListingLine
+	Dependencies []string // the paths of every file that was used, including binary files and images
+}
+
+const magic = "GBASMOBJ"
+
+// version has to be changed whenever the format of Object changes, so that old object files aren't read with things missing.
+const version = 2
+
+// New creates an empty object.
+func New() *Object {
+	return &Object{
+		Constants:    map[string]int{},
+		Sections:     []*Section{},
+		Assertions:   []Assertion{},
+		Listing:      []ListingLine{},
+		Dependencies: []string{},
+	}
+}
+
+// FindSection returns the section with the given name, or nil if there isn't one.
+func (o *Object) FindSection(name string) *Section {
+	for _, section := range o.Sections {
+		if section.Name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+// Read reads an object file.
+func Read(reader io.Reader) (*Object, error) {
+	bufferedReader := bufio.NewReader(reader)
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(bufferedReader, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, errors.New("not a gbasm object file")
+	}
+	if header[len(magic)] != version {
+		return nil, errors.New("object file was made by a different version of gbasm, it has to be assembled again")
+	}
+
+	result := New()
+	if err := gob.NewDecoder(bufferedReader).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Write writes an object file.
+func Write(writer io.Writer, o *Object) error {
+	if _, err := writer.Write(append([]byte(magic), version)); err != nil {
+		return err
+	}
+	return gob.NewEncoder(writer).Encode(o)
+}
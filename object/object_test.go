@@ -0,0 +1,48 @@
+package object
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	original := New()
+	original.Constants["LCDC"] = 0xFF40
+	original.Sections = append(original.Sections, &Section{
+		Name:        "code",
+		Type:        "ROMX",
+		Bank:        Unspecified,
+		Address:     0x4000,
+		Size:        3,
+		Data:        []byte{0xCD, 0x00, 0x00},
+		Symbols:     []Symbol{{"Routine", 0, "test.s", 2}},
+		Relocations: []Relocation{{0, 3, "CALL", []string{"Other"}, "test.s", 3}},
+		File:        "test.s",
+		Line:        1,
+	})
+
+	buffer := bytes.Buffer{}
+	if err := Write(&buffer, original); err != nil {
+		t.Fatalf("Write failed with '%s'", err)
+	}
+	result, err := Read(&buffer)
+	if err != nil {
+		t.Fatalf("Read failed with '%s'", err)
+	}
+	if !reflect.DeepEqual(original, result) {
+		t.Errorf("Object was %+v after reading it back, should have been %+v", result, original)
+	}
+
+	if _, err := Read(bytes.NewBufferString("not an object")); err == nil {
+		t.Errorf("Reading something that isn't an object should fail")
+	}
+
+	// objects from before sections had alignment and such
+	buffer.Reset()
+	Write(&buffer, original)
+	buffer.Bytes()[len(magic)] = 1
+	if _, err := Read(&buffer); err == nil {
+		t.Errorf("Reading an object from an older version should fail")
+	}
+}
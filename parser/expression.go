@@ -0,0 +1,506 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+	"github.com/thatoddmailbox/gbasm/utils"
+)
+
+// NodeType is the kind of thing that a node in an expression is.
+type NodeType int
+
+const (
+	NodeNumber NodeType = iota
+	NodeSymbol
+	NodeUnary
+	NodeBinary
+	NodeCall
+	NodeString
+)
+
+// A Node is one part of a parsed expression.
+type Node struct {
+	Type     NodeType
+	Value    int     // for numbers
+	Name     string  // the symbol name, operator, function name, or contents of a string
+	Children []*Node // the operands, or the function's arguments
+}
+
+// BinaryOperators contains the precedence of each binary operator, higher goes first. They're all left-associative.
+var BinaryOperators = map[string]int{
+	"*":  10,
+	"/":  10,
+	"%":  10,
+	"+":  9,
+	"-":  9,
+	"<<": 8,
+	">>": 8,
+	"<":  7,
+	">":  7,
+	"<=": 7,
+	">=": 7,
+	"==": 6,
+	"!=": 6,
+	"&":  5,
+	"^":  4,
+	"|":  3,
+	"&&": 2,
+	"||": 1,
+}
+
+// UnaryOperators contains the operators that can go in front of a value.
+var UnaryOperators = []string{"-", "+", "~", "!"}
+
+// TokenizeExpression splits the given expression into numbers, names, and operators.
+func TokenizeExpression(expression string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(expression); i++ {
+		char := expression[i]
+		if char == ' ' || char == '\t' {
+			continue
+		}
+
+		if char == '\'' {
+			// it's a character
+			if i+2 >= len(expression) || expression[i+2] != '\'' {
+				return nil, errors.New("Expected one character between single quotes")
+			}
+			tokens = append(tokens, expression[i:i+3])
+			i += 2
+			continue
+		}
+
+		if char == '"' {
+			// it's a string, which can only be used as an argument to a function
+			end := strings.IndexByte(expression[i+1:], '"')
+			if end == -1 {
+				return nil, errors.New("Missing '\"' at end of string")
+			}
+			tokens = append(tokens, expression[i:i+end+2])
+			i += end + 1
+			continue
+		}
+
+		if i+1 < len(expression) && isNumberPrefix(char, expression[i+1], tokens) {
+			// it's a number like $FF, %1010, or &777
+			end := i + 1
+			for end < len(expression) && isNameCharacter(expression[end]) {
+				end++
+			}
+			tokens = append(tokens, expression[i:end])
+			i = end - 1
+			continue
+		}
+
+		if isNameCharacter(char) {
+			// it's a number or name
+			end := i
+			for end < len(expression) && isNameCharacter(expression[end]) {
+				end++
+			}
+			tokens = append(tokens, expression[i:end])
+			i = end - 1
+			continue
+		}
+
+		if i+1 < len(expression) {
+			if _, isOperator := BinaryOperators[expression[i:i+2]]; isOperator {
+				tokens = append(tokens, expression[i:i+2])
+				i++
+				continue
+			}
+		}
+
+		if strings.IndexByte("+-*/%&|^~!<>(),", char) == -1 {
+			return nil, fmt.Errorf("Unexpected '%c'", char)
+		}
+		tokens = append(tokens, string(char))
+	}
+	return tokens, nil
+}
+
+// isNumberPrefix returns true if the given character starts a number, rather than being an operator.
+// % and & are only prefixes where a value is expected, so that 7 %10 is still 7 modulo 10.
+func isNumberPrefix(char byte, nextChar byte, tokens []string) bool {
+	if char == '$' {
+		return isNameCharacter(nextChar)
+	}
+	if char != '%' && char != '&' {
+		return false
+	}
+	if char == '%' && nextChar != '0' && nextChar != '1' {
+		return false
+	}
+	if char == '&' && (nextChar < '0' || nextChar > '7') {
+		return false
+	}
+	if len(tokens) == 0 {
+		return true
+	}
+	lastToken := tokens[len(tokens)-1]
+	_, afterBinaryOperator := BinaryOperators[lastToken]
+	return afterBinaryOperator || lastToken == "(" || lastToken == "," || lastToken == "~" || lastToken == "!"
+}
+
+func isNameCharacter(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_' || char == '.'
+}
+
+// an expressionParser keeps track of where it is in the tokens of an expression
+type expressionParser struct {
+	tokens   []string
+	position int
+}
+
+func (p *expressionParser) peek() string {
+	if p.position >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.position]
+}
+
+func (p *expressionParser) next() string {
+	token := p.peek()
+	p.position++
+	return token
+}
+
+// ParseExpression parses the given expression into a tree of nodes.
+func ParseExpression(expression string) (*Node, error) {
+	tokens, err := TokenizeExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("Empty expression")
+	}
+
+	p := &expressionParser{tokens, 0}
+	node, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if p.position < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected '%s'", p.peek())
+	}
+	return node, nil
+}
+
+// parseBinary parses operators with at least the given precedence, using precedence climbing.
+func (p *expressionParser) parseBinary(minPrecedence int) (*Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator := p.peek()
+		precedence, isOperator := BinaryOperators[operator]
+		if !isOperator || precedence < minPrecedence {
+			return left, nil
+		}
+		p.next()
+
+		// the right side only gets operators that go first, which makes everything left-associative
+		right, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &Node{Type: NodeBinary, Name: operator, Children: []*Node{left, right}}
+	}
+}
+
+func (p *expressionParser) parseUnary() (*Node, error) {
+	for _, operator := range UnaryOperators {
+		if p.peek() == operator {
+			p.next()
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &Node{Type: NodeUnary, Name: operator, Children: []*Node{operand}}, nil
+		}
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (*Node, error) {
+	token := p.next()
+	if token == "" {
+		return nil, errors.New("Missing value at end of expression")
+	}
+
+	if token == "(" {
+		node, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("Missing ')'")
+		}
+		return node, nil
+	}
+
+	if num, ok := ParseNumber(token); ok {
+		return &Node{Type: NodeNumber, Value: num}, nil
+	}
+
+	if token[0] == '"' {
+		return &Node{Type: NodeString, Name: token[1 : len(token)-1]}, nil
+	}
+
+	if !IsSymbolName(token) {
+		return nil, fmt.Errorf("Unexpected '%s'", token)
+	}
+
+	if p.peek() != "(" {
+		return &Node{Type: NodeSymbol, Name: token}, nil
+	}
+
+	// it's a function call
+	p.next()
+	node := &Node{Type: NodeCall, Name: strings.ToUpper(token), Children: []*Node{}}
+	if p.peek() == ")" {
+		p.next()
+		return node, nil
+	}
+	for {
+		argument, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, argument)
+
+		separator := p.next()
+		if separator == ")" {
+			return node, nil
+		}
+		if separator != "," {
+			return nil, fmt.Errorf("Expected ',' or ')' in arguments to %s", node.Name)
+		}
+	}
+}
+
+// Evaluate works out the value of the given expression, using the labels and constants in rom.Current.
+func Evaluate(node *Node) (int, error) {
+	switch node.Type {
+	case NodeNumber:
+		return node.Value, nil
+
+	case NodeSymbol:
+		value, isDefinition := rom.Current.Definitions[node.Name]
+		if isDefinition {
+			return value, nil
+		}
+		if rom.Current.Relocatable {
+			// it's a label that hasn't been placed yet (maybe in another file)
+			// use 0 as padding just so we can calculate where stuff is correctly
+			// the actual value will be filled in by the linker
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Unknown label or constant '%s'", node.Name)
+
+	case NodeUnary:
+		operand, err := Evaluate(node.Children[0])
+		if err != nil {
+			return 0, err
+		}
+		switch node.Name {
+		case "-":
+			return -operand, nil
+		case "+":
+			return operand, nil
+		case "~":
+			return ^operand, nil
+		case "!":
+			return boolToInt(operand == 0), nil
+		}
+
+	case NodeBinary:
+		first, err := Evaluate(node.Children[0])
+		if err != nil {
+			return 0, err
+		}
+		second, err := Evaluate(node.Children[1])
+		if err != nil {
+			return 0, err
+		}
+		return evaluateBinary(node.Name, first, second)
+
+	case NodeCall:
+		return evaluateCall(node)
+
+	case NodeString:
+		return 0, fmt.Errorf("Unexpected string \"%s\"", node.Name)
+	}
+
+	return 0, fmt.Errorf("Can't evaluate '%s'", node.Name)
+}
+
+func evaluateBinary(operator string, first int, second int) (int, error) {
+	switch operator {
+	case "*":
+		return first * second, nil
+	case "/", "%":
+		if second == 0 {
+			return 0, errors.New("Division by zero")
+		}
+		if operator == "/" {
+			return first / second, nil
+		}
+		return first % second, nil
+	case "+":
+		return first + second, nil
+	case "-":
+		return first - second, nil
+	case "<<":
+		return first << uint(second), nil
+	case ">>":
+		return first >> uint(second), nil
+	case "<":
+		return boolToInt(first < second), nil
+	case ">":
+		return boolToInt(first > second), nil
+	case "<=":
+		return boolToInt(first <= second), nil
+	case ">=":
+		return boolToInt(first >= second), nil
+	case "==":
+		return boolToInt(first == second), nil
+	case "!=":
+		return boolToInt(first != second), nil
+	case "&":
+		return first & second, nil
+	case "^":
+		return first ^ second, nil
+	case "|":
+		return first | second, nil
+	case "&&":
+		return boolToInt(first != 0 && second != 0), nil
+	case "||":
+		return boolToInt(first != 0 || second != 0), nil
+	}
+	return 0, fmt.Errorf("Unknown operator '%s'", operator)
+}
+
+func evaluateCall(node *Node) (int, error) {
+	switch node.Name {
+	case "HIGH", "LOW":
+		if len(node.Children) != 1 {
+			return 0, fmt.Errorf("Expected %s(value)", node.Name)
+		}
+		value, err := Evaluate(node.Children[0])
+		if err != nil {
+			return 0, err
+		}
+		if node.Name == "HIGH" {
+			return (value >> 8) & 0xFF, nil
+		}
+		return value & 0xFF, nil
+
+	case "BANK":
+		if len(node.Children) != 1 || node.Children[0].Type != NodeSymbol {
+			return 0, errors.New("Expected BANK(label)")
+		}
+		labelName := node.Children[0].Name
+		label, isLabel := rom.Current.Labels[labelName]
+		if !isLabel {
+			if !rom.Current.Relocatable {
+				return 0, fmt.Errorf("Unknown label '%s' in BANK()", labelName)
+			}
+			// the label hasn't been placed yet, the linker will fill it in
+			label = rom.Label{}
+		}
+		return label.Bank, nil
+
+	case "SIZEOF":
+		if len(node.Children) != 1 || (node.Children[0].Type != NodeString && node.Children[0].Type != NodeSymbol) {
+			return 0, errors.New("Expected SIZEOF(\"section\")")
+		}
+		sectionName := node.Children[0].Name
+		size, isSection := rom.Current.SectionSizes[sectionName]
+		if !isSection {
+			if !rom.Current.Relocatable {
+				return 0, fmt.Errorf("Unknown section '%s' in SIZEOF()", sectionName)
+			}
+			// sections can keep growing until the whole file is assembled, so the linker fills this in
+			return 0, nil
+		}
+		return size, nil
+
+	case "STRLEN":
+		if len(node.Children) != 1 || node.Children[0].Type != NodeString {
+			return 0, errors.New("Expected STRLEN(\"string\")")
+		}
+		return len(node.Children[0].Name), nil
+
+	case "DEF":
+		if len(node.Children) != 1 || node.Children[0].Type != NodeSymbol {
+			return 0, errors.New("Expected DEF(name)")
+		}
+		return boolToInt(IsDefined(node.Children[0].Name)), nil
+
+	case "MIN", "MAX":
+		if len(node.Children) == 0 {
+			return 0, fmt.Errorf("Expected %s(value, value...)", node.Name)
+		}
+		result := 0
+		for i, child := range node.Children {
+			value, err := Evaluate(child)
+			if err != nil {
+				return 0, err
+			}
+			if i == 0 || (node.Name == "MIN" && value < result) || (node.Name == "MAX" && value > result) {
+				result = value
+			}
+		}
+		return result, nil
+	}
+	return 0, fmt.Errorf("Unknown function '%s'", node.Name)
+}
+
+// IsDefined returns true if the given name is a constant or label that has been declared so far.
+// Definitions has every constant from the first pass, so it can't be used for this.
+func IsDefined(name string) bool {
+	isConstant := utils.StringInSlice(name, rom.Current.DeclaredConstants)
+	_, isLabel := rom.Current.Labels[name]
+	return isConstant || isLabel || utils.StringInSlice(name, rom.Current.UnpointedDefinitions)
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// ReferencesUnknownSymbols returns true if the given expression uses any names that aren't constants, like labels.
+func ReferencesUnknownSymbols(node *Node) bool {
+	if node.Type == NodeSymbol {
+		_, isDefinition := rom.Current.Definitions[node.Name]
+		return !isDefinition
+	}
+	if node.Type == NodeCall {
+		switch node.Name {
+		case "DEF", "STRLEN":
+			// these are known right away
+			return false
+		case "SIZEOF":
+			// sizes are only known once everything has been assembled
+			if len(node.Children) == 1 {
+				_, isKnown := rom.Current.SectionSizes[node.Children[0].Name]
+				return !isKnown
+			}
+			return true
+		}
+	}
+	for _, child := range node.Children {
+		if ReferencesUnknownSymbols(child) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,10 @@
 package parser
 
 import (
-	"log"
 	"strconv"
 	"strings"
 
-	"github.com/thatoddmailbox/gbasm/rom"
+	"github.com/thatoddmailbox/gbasm/diagnostics"
 	"github.com/thatoddmailbox/gbasm/utils"
 )
 
@@ -28,6 +27,11 @@ var RegisterNames16 = []string{
 	"[DE]",
 	"HL",
 	"[HL]",
+	"[HL+]",
+	"[HL-]",
+	"[HLI]",
+	"[HLD]",
+	"[C]",
 	"PC",
 	"SP",
 }
@@ -43,33 +47,26 @@ var ConditionCodes = []string{
 	"M",
 }
 
-var Tokens = map[string]int{
-	"*":  6,
-	"/":  6,
-	"+":  5,
-	"-":  5,
-	">>": 4,
-	"<<": 4,
-	"&":  3,
-	"^":  2,
-	"|":  1,
+// NumberPrefixes maps the other ways of writing binary, octal, and hexadecimal numbers to the ones Go understands.
+var NumberPrefixes = map[byte]string{
+	'$': "0x",
+	'%': "0b",
+	'&': "0o",
 }
 
 // ParseNumber parses the given string as a numeric constant.
+// It understands everything Go does (including _ between digits), as well as $, %, and & prefixes.
 func ParseNumber(numString string) (int, bool) {
 	numString = strings.TrimSpace(numString)
-	if strings.HasPrefix(numString, "0b") {
-		// it's a binary number
-		num, err := strconv.ParseInt(numString[2:], 2, 0)
-		if err != nil {
-			return 0, false
-		}
-		return int(num), true
-	}
 	if len(numString) == 3 && numString[0] == '\'' && numString[2] == '\'' {
 		// it's a character
 		return int(numString[1]), true
 	}
+	if len(numString) > 1 {
+		if prefix, hasPrefix := NumberPrefixes[numString[0]]; hasPrefix {
+			numString = prefix + numString[1:]
+		}
+	}
 	num, err := strconv.ParseInt(numString, 0, 0)
 	if err != nil {
 		return 0, false
@@ -77,180 +74,92 @@ func ParseNumber(numString string) (int, bool) {
 	return int(num), true
 }
 
-func ParseExpressionTokens(expression string) []string {
-	tokens := []string{}
-	buf := ""
-	inAString := false
-
-	for i := 0; i < len(expression); i++ {
-		char := expression[i]
-		if char == '"' || char == '\'' {
-			buf = buf + string(char)
-			inAString = !inAString
-		} else if inAString {
-			buf = buf + string(char)
-		} else if (char == '(' || char == ')') ||
-			(char == '+' || char == '-' || char == '*' || char == '/') ||
-			(char == '&' || char == '|' || char == '^') ||
-			(char == '>' || char == '<') {
-			if buf != "" {
-				tokens = append(tokens, buf)
-			}
-			buf = ""
-
-			if char == '>' || char == '<' {
-				// is it a bitshift operator?
-				// if so, is the next character the same?
-				if i+1 < len(expression) && char == expression[i+1] {
-					// then add the token and ignore the next character
-					tokens = append(tokens, string(char)+string(char))
-					i++
-					continue
-				}
-			}
-
-			tokens = append(tokens, string(char))
-		} else if char == ' ' {
-			if buf != "" {
-				tokens = append(tokens, buf)
-			}
-			buf = ""
-		} else {
-			buf = buf + string(char)
+// IsSymbolName returns true if the given token could be the name of a label or constant.
+func IsSymbolName(token string) bool {
+	if token == "" || utils.StringInSlice(strings.ToUpper(token), append(append(RegisterNames8, RegisterNames16...), ConditionCodes...)) {
+		return false
+	}
+	for i := 0; i < len(token); i++ {
+		char := token[i]
+		isLetter := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_' || char == '.'
+		isDigit := (char >= '0' && char <= '9')
+		if !isLetter && (i == 0 || !isDigit) {
+			return false
 		}
 	}
+	return true
+}
 
-	if buf != "" {
-		tokens = append(tokens, buf)
+// ReferencesSymbols returns true if the given expression refers to anything that isn't a constant, like a label.
+// The value of an expression like that is only known once the linker has placed everything.
+func ReferencesSymbols(expression string) bool {
+	expression, _, isExpression := prepareExpression(expression)
+	if !isExpression {
+		return false
 	}
 
-	return tokens
-}
-
-func IsSecondOperatorMoreImportantThanFirst(first string, second string) bool {
-	return Tokens[second] > Tokens[first]
+	node, err := ParseExpression(expression)
+	if err != nil {
+		// let whatever evaluates it report the error
+		return false
+	}
+	return ReferencesUnknownSymbols(node)
 }
 
-func SimplifyPotentialExpression(expression string, pass int, fileBase string, lineNumber int) string {
+// prepareExpression removes the parts of an operand that aren't part of an expression.
+// It returns the expression, what goes in front of it (like [ or SP+), and false if there's no expression at all.
+func prepareExpression(expression string) (string, string, bool) {
 	expression = strings.TrimSpace(expression)
 
 	if utils.StringInSlice(strings.ToUpper(expression), append(append(RegisterNames8, RegisterNames16...), ConditionCodes...)) {
-		return expression
+		return expression, "", false
 	}
 
-	if expression[0] == '"' && expression[len(expression)-1] == '"' {
+	if len(expression) > 1 && expression[0] == '"' && expression[len(expression)-1] == '"' {
 		// it's a string
-		return expression
+		return expression, "", false
 	}
 
-	isIndirectAccess := false
-	if expression[0] == '[' && expression[len(expression)-1] == ']' {
-		// remove the brackets for now, add them back at the end
-		isIndirectAccess = true
-		expression = expression[1 : len(expression)-1]
+	if len(expression) > 2 && strings.ToUpper(expression[:2]) == "SP" {
+		offset := strings.TrimSpace(expression[2:])
+		if len(offset) > 1 && (offset[0] == '+' || offset[0] == '-') {
+			// it's a stack pointer plus an offset, so only the offset is an expression
+			return offset[1:], "SP" + string(offset[0]), true
+		}
 	}
 
-	tokens := ParseExpressionTokens(expression)
-
-	// https://en.wikipedia.org/wiki/Shunting-yard_algorithm
+	if len(expression) > 1 && expression[0] == '[' && expression[len(expression)-1] == ']' {
+		return expression[1 : len(expression)-1], "[", true
+	}
 
-	outputStack := []string{}
-	operatorStack := []string{}
-	poppedToken := ""
+	return expression, "", true
+}
 
-	for _, token := range tokens {
-		num, ok := ParseNumber(token)
-		definedVal, isDefinition := rom.Current.Definitions[token]
-		if pass == 0 {
-			// it's the first pass, so check if there's something that's in need of pointing
-			if !isDefinition && utils.StringInSlice(token, rom.Current.UnpointedDefinitions) {
-				// there is! use 0 as padding just so we can calculate where stuff is correctly
-				// the actual value will be filled in on the second pass
-				definedVal = 0
-				isDefinition = true
-			}
-		}
-		if ok {
-			// the token is a number
-			outputStack = append(outputStack, strconv.Itoa(num))
-		} else if isDefinition {
-			// the token is a number, but defined
-			outputStack = append(outputStack, strconv.Itoa(definedVal))
-		} else if token == "(" {
-			operatorStack = append(operatorStack, token)
-		} else if token == ")" {
-			for operatorStack[len(operatorStack)-1] != "(" {
-				poppedToken, operatorStack = operatorStack[len(operatorStack)-1], operatorStack[:len(operatorStack)-1]
-				outputStack = append(outputStack, poppedToken)
-			}
-			if len(operatorStack) == 0 {
-				log.Fatalf("Extra ')' at %s:%d", fileBase, lineNumber)
-			}
-			// remove the left parenthesis
-			operatorStack = operatorStack[:len(operatorStack)-1]
-		} else {
-			// is there an operator with a greater precedence at the top?
-			for len(operatorStack) > 0 && IsSecondOperatorMoreImportantThanFirst(token, operatorStack[len(operatorStack)-1]) {
-				poppedToken, operatorStack = operatorStack[len(operatorStack)-1], operatorStack[:len(operatorStack)-1]
-				outputStack = append(outputStack, poppedToken)
-			}
-			operatorStack = append(operatorStack, token)
-		}
-	}
-	for len(operatorStack) > 0 {
-		poppedToken, operatorStack = operatorStack[len(operatorStack)-1], operatorStack[:len(operatorStack)-1]
-		if poppedToken == "(" || poppedToken == ")" {
-			log.Fatalf("Extra '%s' at %s:%d", poppedToken, fileBase, lineNumber)
-		}
-		outputStack = append(outputStack, poppedToken)
+// SimplifyPotentialExpression works out the value of the given operand if it's an expression, and returns it as a string.
+// Anything else, like a register name or a string, is returned as it is.
+func SimplifyPotentialExpression(expression string, pass int, fileBase string, lineNumber int) string {
+	inner, prefix, isExpression := prepareExpression(expression)
+	if !isExpression {
+		return inner
 	}
 
-	rpnStack := []int{}
-	for _, token := range outputStack {
-		val, err := strconv.Atoi(token)
-		if err == nil {
-			// it's a number, add it to the stack
-			rpnStack = append(rpnStack, val)
-		} else {
-			// it's an operand that requires 2 parameters
-			if len(rpnStack) < 2 {
-				log.Fatalf("Error parsing expression '%s' at %s:%d", expression, fileBase, lineNumber)
-			}
-			first, second := 0, 0
-			second, rpnStack = rpnStack[len(rpnStack)-1], rpnStack[:len(rpnStack)-1]
-			first, rpnStack = rpnStack[len(rpnStack)-1], rpnStack[:len(rpnStack)-1]
-			if token == "+" {
-				rpnStack = append(rpnStack, first+second)
-			} else if token == "-" {
-				rpnStack = append(rpnStack, first-second)
-			} else if token == "*" {
-				rpnStack = append(rpnStack, first*second)
-			} else if token == "/" {
-				rpnStack = append(rpnStack, first/second)
-			} else if token == ">>" {
-				rpnStack = append(rpnStack, int(uint(first)>>uint(second)))
-			} else if token == "<<" {
-				rpnStack = append(rpnStack, int(uint(first)<<uint(second)))
-			} else if token == "|" {
-				rpnStack = append(rpnStack, first|second)
-			} else if token == "&" {
-				rpnStack = append(rpnStack, first&second)
-			} else if token == "^" {
-				rpnStack = append(rpnStack, first&second)
-			} else {
-				log.Fatalf("Unknown token '%s' when parsing expression '%s' at %s:%d", token, expression, fileBase, lineNumber)
-			}
-		}
+	node, err := ParseExpression(inner)
+	if err != nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "%s in expression '%s'", err, inner)
 	}
-
-	if len(rpnStack) == 0 || len(rpnStack) > 1 {
-		log.Fatalf("Missing operands for expression '%s' at %s:%d", expression, fileBase, lineNumber)
+	value, err := Evaluate(node)
+	if err != nil {
+		diagnostics.Fatalf(fileBase, lineNumber, "%s in expression '%s'", err, inner)
 	}
 
-	result := strconv.Itoa(rpnStack[0])
-	if isIndirectAccess {
+	result := strconv.Itoa(value)
+	if prefix == "SP-" {
+		// the sign is part of the offset
+		result = "SP-" + result
+	} else if prefix == "SP+" {
+		result = "SP+" + result
+	} else if prefix == "[" {
 		result = "[" + result + "]"
 	}
-
 	return result
 }
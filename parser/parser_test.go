@@ -0,0 +1,230 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/thatoddmailbox/gbasm/rom"
+)
+
+func setUpSymbols(relocatable bool) {
+	rom.Current.Definitions = map[string]int{"FIVE": 5, "Parent.child": 7, "LATER": 9}
+	rom.Current.DeclaredConstants = []string{"FIVE", "Parent.child"}
+	rom.Current.Labels = map[string]rom.Label{"far": rom.Label{Bank: 3, Address: 0x4000}}
+	rom.Current.SectionSizes = map[string]int{}
+	if !relocatable {
+		// section sizes are only known once everything is assembled
+		rom.Current.SectionSizes["Graphics"] = 0x800
+	}
+	rom.Current.UnpointedDefinitions = []string{"declared"}
+	rom.Current.Relocatable = relocatable
+}
+
+func TestEvaluate(t *testing.T) {
+	setUpSymbols(false)
+
+	tests := map[string]int{
+		"1 + 2 * 3":              7,
+		"(1 + 2) * 3":            9,
+		"2 - 3 + 4":              3,
+		"1 - 2 - 3":              -4,
+		"100 / 10 / 5":           2,
+		"7 % 4":                  3,
+		"2 * 3 % 4":              2,
+		"-1":                     -1,
+		"- -2":                   2,
+		"+3":                     3,
+		"-FIVE * -FIVE":          25,
+		"~0":                     -1,
+		"~0 & 0xFF":              0xFF,
+		"!0":                     1,
+		"!5":                     0,
+		"6 ^ 3":                  5,
+		"6 | 3":                  7,
+		"6 & 3":                  2,
+		"0xFF & ~0x0F | 1 << 1":  0xF2,
+		"1 << 4 + 1":             32,
+		"0x8000 >> 8":            0x80,
+		"-16 >> 2":               -4,
+		"FIVE == 5":              1,
+		"FIVE != 5":              0,
+		"1 + 2 == 3":             1,
+		"1 | 2 == 2":             1,
+		"1 < 2 == 2 > 1":         1,
+		"FIVE < 6 && FIVE > 4":   1,
+		"FIVE <= 4 || FIVE >= 6": 0,
+		"'A' + 1":                66,
+		"$FF40":                  0xFF40,
+		"$ff + 1":                0x100,
+		"%00011011":              0x1B,
+		"%1010 % 3":              1,
+		"7 %10":                  7,
+		"7 % %11":                1,
+		"(%11)":                  3,
+		"-%10":                   -2,
+		"&777":                   0x1FF,
+		"&10 & &7":               0,
+		"6 &7":                   6,
+		"1 && &7":                1,
+		"MAX(&10, %1)":           8,
+		"1_000":                  1000,
+		"$FF_00":                 0xFF00,
+		"%1111_0000":             0xF0,
+		"0b1010":                 10,
+		"((((FIVE))))":           5,
+		"Parent.child * 2":       14,
+		"BANK(far)":              3,
+		"bank(far) + 1":          4,
+		"HIGH(0x1234)":           0x12,
+		"LOW(0x1234)":            0x34,
+		"high(-1)":               0xFF,
+		"HIGH(FIVE << 8 | 0xFF)": 5,
+		"SIZEOF(\"Graphics\")":   0x800,
+		"SIZEOF(Graphics) / 16":  0x80,
+		"STRLEN(\"hello\")":      5,
+		"STRLEN(\"a, b\") + 1":   5,
+		"STRLEN(\"\")":           0,
+		"DEF(FIVE)":              1,
+		"DEF(far)":               1,
+		"DEF(declared)":          1,
+		"DEF(nothing)":           0,
+		"DEF(LATER)":             0,
+		"!DEF(nothing)":          1,
+		"MIN(3, 1, 2)":           1,
+		"MAX(3, 1, 2)":           3,
+		"MAX(-5)":                -5,
+		"MIN(FIVE, MAX(1, 2))":   2,
+	}
+	for expression, expected := range tests {
+		node, err := ParseExpression(expression)
+		if err != nil {
+			t.Errorf("Couldn't parse '%s': %s", expression, err)
+			continue
+		}
+		value, err := Evaluate(node)
+		if err != nil {
+			t.Errorf("Couldn't evaluate '%s': %s", expression, err)
+			continue
+		}
+		if value != expected {
+			t.Errorf("'%s' was %d, should have been %d", expression, value, expected)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	setUpSymbols(false)
+
+	parseErrors := []string{"", "(1", "1)", "1 +", "* 2", "1 2", "BANK(far", "1 $ 2", "STRLEN(\"oops)", "MIN(1,)"}
+	for _, expression := range parseErrors {
+		if _, err := ParseExpression(expression); err == nil {
+			t.Errorf("Parsing '%s' should have failed", expression)
+		}
+	}
+
+	evaluateErrors := []string{"1 / 0", "1 % (FIVE - 5)", "unknown + 1", "BANK(unknown)", "NOPE(1)",
+		"HIGH()", "LOW(1, 2)", "SIZEOF(\"Nope\")", "SIZEOF(1)", "STRLEN(FIVE)", "DEF(1)", "MIN()", "\"string\" + 1"}
+	for _, expression := range evaluateErrors {
+		node, err := ParseExpression(expression)
+		if err != nil {
+			t.Errorf("Couldn't parse '%s': %s", expression, err)
+			continue
+		}
+		if _, err := Evaluate(node); err == nil {
+			t.Errorf("Evaluating '%s' should have failed", expression)
+		}
+	}
+}
+
+func TestRelocatableSymbols(t *testing.T) {
+	setUpSymbols(true)
+	defer setUpSymbols(false)
+
+	node, err := ParseExpression("label + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := Evaluate(node)
+	if err != nil {
+		t.Errorf("Unknown symbols should be allowed before linking, got %s", err)
+	}
+	if value != 1 {
+		t.Errorf("Unknown symbols should be 0 before linking, got %d", value-1)
+	}
+
+	tests := map[string]bool{
+		"label + 1":            true,
+		"[label]":              true,
+		"BANK(label)":          true,
+		"HIGH(label)":          true,
+		"SIZEOF(\"Graphics\")": true,
+		"DEF(label)":           false,
+		"STRLEN(\"label\")":    false,
+		"MAX(FIVE, 2)":         false,
+		"FIVE + 1":             false,
+		"[FIVE]":               false,
+		"SP+FIVE":              false,
+		"HL":                   false,
+		"[HL+]":                false,
+		"\"string\"":           false,
+	}
+	for expression, expected := range tests {
+		if ReferencesSymbols(expression) != expected {
+			t.Errorf("ReferencesSymbols('%s') should have been %t", expression, expected)
+		}
+	}
+}
+
+func TestSimplifyPotentialExpression(t *testing.T) {
+	setUpSymbols(false)
+
+	tests := map[string]string{
+		"FIVE + 1":        "6",
+		"2 - 3 + 4":       "3",
+		"[0xFF00 + 0x40]": "[65344]",
+		"SP+FIVE":         "SP+5",
+		"SP-2":            "SP-2",
+		"A":               "A",
+		"[HL]":            "[HL]",
+		"nz":              "nz",
+		"\"hi there\"":    "\"hi there\"",
+	}
+	for expression, expected := range tests {
+		result := SimplifyPotentialExpression(expression, 1, "test.s", 1)
+		if result != expected {
+			t.Errorf("'%s' simplified to '%s', should have been '%s'", expression, result, expected)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := map[string]int{
+		"42":         42,
+		" 42 ":       42,
+		"0x2A":       42,
+		"0X2a":       42,
+		"$2A":        42,
+		"0b101010":   42,
+		"%101010":    42,
+		"0o52":       42,
+		"&52":        42,
+		"052":        42,
+		"4_2":        42,
+		"0x_2A":      42,
+		"%0010_1010": 42,
+		"'*'":        42,
+	}
+	for numString, expected := range tests {
+		num, ok := ParseNumber(numString)
+		if !ok {
+			t.Errorf("Couldn't parse '%s'", numString)
+		} else if num != expected {
+			t.Errorf("'%s' was %d, should have been %d", numString, num, expected)
+		}
+	}
+
+	for _, numString := range []string{"", "$", "%", "&", "$G", "%2", "&8", "_42", "42_", "4__2", "abc", "'ab'"} {
+		if _, ok := ParseNumber(numString); ok {
+			t.Errorf("Parsing '%s' should have failed", numString)
+		}
+	}
+}
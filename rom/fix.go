@@ -0,0 +1,101 @@
+package rom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/thatoddmailbox/gbasm/utils"
+)
+
+// FixOptions says what to change in the header of a ROM, other than the checksums.
+type FixOptions struct {
+	Title         string // replaced if it's not empty
+	FixLogo       bool   // puts the real logo back
+	CartridgeType *byte  // replaced if it's not nil
+	Pad           bool   // pads the ROM to a power of two, and sets the ROM size to match
+	PadValue      byte
+}
+
+// Fix repairs the header and checksums of an existing ROM, with the given changes.
+// It returns the fixed ROM, which might be longer if it was padded, and a description of everything that changed.
+func Fix(data []byte, options FixOptions) ([]byte, []string, error) {
+	if len(data) < 0x150 {
+		return nil, nil, errors.New("ROM is too small to have a header!")
+	}
+	result := append([]byte{}, data...)
+	changes := []string{}
+
+	if options.Title != "" {
+		// the CGB flag is the last byte of the title on older games
+		maxLength := 16
+		if result[0x143]&0x80 != 0 {
+			maxLength = 15
+		}
+		if len(options.Title) > maxLength {
+			return nil, nil, fmt.Errorf("Title can't be longer than %d characters!", maxLength)
+		}
+		if !isPrintableASCII(options.Title) {
+			return nil, nil, errors.New("Title can only have ASCII characters!")
+		}
+
+		title := make([]byte, maxLength)
+		copy(title, options.Title)
+		oldTitle := strings.TrimRight(string(result[0x134:0x134+maxLength]), "\x00")
+		copy(result[0x134:], title)
+		if oldTitle != options.Title {
+			changes = append(changes, fmt.Sprintf("Title: '%s' -> '%s'", oldTitle, options.Title))
+		}
+	}
+
+	if options.FixLogo && string(result[0x104:0x134]) != string(LogoBitmap) {
+		copy(result[0x104:], LogoBitmap)
+		changes = append(changes, "Logo: fixed")
+	}
+
+	if options.CartridgeType != nil && result[0x147] != *options.CartridgeType {
+		changes = append(changes, fmt.Sprintf("Cartridge type: 0x%02X -> 0x%02X", result[0x147], *options.CartridgeType))
+		result[0x147] = *options.CartridgeType
+	}
+
+	if options.Pad {
+		// the smallest size is 32 KiB, with a size code of 0
+		romSize := 32 * utils.KiB
+		romSizeCode := byte(0)
+		for romSize < len(result) {
+			romSize *= 2
+			romSizeCode++
+		}
+		if romSizeCode > 8 {
+			return nil, nil, errors.New("ROM is too big to pad to a valid size!")
+		}
+
+		if romSize > len(result) {
+			changes = append(changes, fmt.Sprintf("Size: padded from %d to %d bytes with 0x%02X", len(result), romSize, options.PadValue))
+			for len(result) < romSize {
+				result = append(result, options.PadValue)
+			}
+		}
+		if result[0x148] != romSizeCode {
+			changes = append(changes, fmt.Sprintf("ROM size: 0x%02X -> 0x%02X", result[0x148], romSizeCode))
+			result[0x148] = romSizeCode
+		}
+	}
+
+	headerChecksum := calculateHeaderChecksum(result[0x134:0x14D])
+	if result[0x14D] != headerChecksum {
+		changes = append(changes, fmt.Sprintf("Header checksum: 0x%02X -> 0x%02X", result[0x14D], headerChecksum))
+		result[0x14D] = headerChecksum
+	}
+
+	// the global checksum doesn't include itself
+	oldGlobalChecksum := int(result[0x14E])<<8 | int(result[0x14F])
+	globalChecksum := (calculateGlobalChecksum(result) - int(result[0x14E]) - int(result[0x14F])) & 0xFFFF
+	if oldGlobalChecksum != globalChecksum {
+		changes = append(changes, fmt.Sprintf("Global checksum: 0x%04X -> 0x%04X", oldGlobalChecksum, globalChecksum))
+		result[0x14E] = byte(globalChecksum >> 8)
+		result[0x14F] = byte(globalChecksum & 0xFF)
+	}
+
+	return result, changes, nil
+}
@@ -0,0 +1,77 @@
+package rom
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/thatoddmailbox/gbasm/utils"
+)
+
+func TestFix(t *testing.T) {
+	Current = ROM{Info: Info{Name: "GAME"}}
+	Initialize()
+	Current.Output[0x150] = 0x12
+	Finalize()
+	assembled := Current.Output
+
+	// an assembled ROM doesn't need anything fixed
+	fixed, changes, err := Fix(assembled, FixOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 || !bytes.Equal(fixed, assembled) {
+		t.Errorf("Fixing an assembled ROM changed %v", changes)
+	}
+
+	// patching it breaks the checksums, and fixing them gets back the original
+	patched := append([]byte{}, assembled...)
+	patched[0x150] = 0x34
+	patched[0x14A] = 0x00
+	fixed, changes, err = Fix(patched, FixOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("Fixing a patched ROM changed %v", changes)
+	}
+	Current.Info.Destination = "JAPAN"
+	Initialize()
+	Current.Output[0x150] = 0x34
+	Finalize()
+	if !bytes.Equal(fixed, Current.Output) {
+		t.Errorf("Fixed ROM was different from assembling it with the same changes")
+	}
+}
+
+func TestFixOptions(t *testing.T) {
+	data := make([]byte, 40*utils.KiB)
+	data[0x143] = 0x80
+	cartridgeType := byte(0x1B)
+
+	fixed, changes, err := Fix(data, FixOptions{Title: "NEW TITLE", FixLogo: true, CartridgeType: &cartridgeType, Pad: true, PadValue: 0xFF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 7 {
+		t.Errorf("Changes were %v", changes)
+	}
+	if string(fixed[0x134:0x144]) != "NEW TITLE\x00\x00\x00\x00\x00\x00\x80" {
+		t.Errorf("Title was '%s'", fixed[0x134:0x144])
+	}
+	if !bytes.Equal(fixed[0x104:0x134], LogoBitmap) {
+		t.Errorf("Logo was % X", fixed[0x104:0x134])
+	}
+	if len(fixed) != 64*utils.KiB || fixed[len(fixed)-1] != 0xFF || fixed[40*utils.KiB-1] != 0x00 {
+		t.Errorf("ROM was padded to %d bytes", len(fixed))
+	}
+	if fixed[0x147] != 0x1B || fixed[0x148] != 0x01 {
+		t.Errorf("Cartridge type and ROM size were 0x%02X and 0x%02X", fixed[0x147], fixed[0x148])
+	}
+
+	if _, _, err := Fix(data, FixOptions{Title: "SIXTEEN CHARS!!!"}); err == nil {
+		t.Errorf("Title that overwrites the CGB flag should not be allowed")
+	}
+	if _, _, err := Fix(data[:0x100], FixOptions{}); err == nil {
+		t.Errorf("ROM without a header should not be allowed")
+	}
+}
@@ -0,0 +1,147 @@
+package rom
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// the values of CGB in info.toml
+const (
+	CGBOnly       = "ONLY"       // the game only runs on the Gameboy Color
+	CGBCompatible = "COMPATIBLE" // the game uses Gameboy Color features, but also runs on the original Gameboy
+	CGBNone       = "NONE"       // the game is for the original Gameboy
+)
+
+var cgbFlags = map[string]byte{
+	CGBOnly:       0xC0,
+	CGBCompatible: 0x80,
+	CGBNone:       0x00,
+}
+
+var destinationCodes = map[string]byte{
+	"JAPAN":    0x00,
+	"OVERSEAS": 0x01,
+}
+
+// the old licensee code that means the new one is used instead, which is needed for SGB support
+const useNewLicensee = 0x33
+
+// GetCGBMode returns if the game is for the Gameboy Color, the original Gameboy, or both.
+func GetCGBMode(info Info) string {
+	if info.CGB == "" {
+		if info.SupportsDMG {
+			return CGBCompatible
+		}
+		return CGBOnly
+	}
+	return strings.ToUpper(info.CGB)
+}
+
+func getCGBFlag(info Info) (byte, error) {
+	flag, ok := cgbFlags[GetCGBMode(info)]
+	if !ok {
+		return 0, errors.New("Unknown CGB mode '" + info.CGB + "', expected ONLY, COMPATIBLE, or NONE!")
+	}
+	if info.SupportsDMG && GetCGBMode(info) != CGBCompatible {
+		return 0, errors.New("SupportsDMG can't be used with CGB mode '" + info.CGB + "'!")
+	}
+	return flag, nil
+}
+
+// getTitle returns the bytes that go in the title area of the header, which also has the manufacturer code.
+// DMG-only games don't have a CGB flag, so their title can be a byte longer.
+func getTitle(info Info) ([]byte, error) {
+	maxLength := 15
+	if GetCGBMode(info) == CGBNone {
+		maxLength = 16
+	}
+	if info.Manufacturer != "" {
+		maxLength = 11
+	}
+	if len(info.Name) > maxLength {
+		return nil, errors.New("Specified name for ROM is too long!")
+	}
+	if !isPrintableASCII(info.Name) {
+		return nil, errors.New("Specified name for ROM can only have ASCII characters!")
+	}
+
+	title := make([]byte, maxLength)
+	copy(title, info.Name) // left over bytes will be null
+	if info.Manufacturer != "" {
+		if len(info.Manufacturer) != 4 || !isPrintableASCII(info.Manufacturer) {
+			return nil, errors.New("Manufacturer code must be 4 ASCII characters!")
+		}
+		title = append(title, info.Manufacturer...)
+	}
+	return title, nil
+}
+
+func getLicensee(info Info) (string, error) {
+	if info.Licensee == "" {
+		return "01", nil
+	}
+	if len(info.Licensee) != 2 || !isPrintableASCII(info.Licensee) {
+		return "", errors.New("Licensee code must be 2 ASCII characters!")
+	}
+	return info.Licensee, nil
+}
+
+func getOldLicensee(info Info) (byte, error) {
+	if info.OldLicensee == nil {
+		return useNewLicensee, nil
+	}
+	if *info.OldLicensee < 0 || *info.OldLicensee > 0xFF {
+		return 0, errors.New("Old licensee code must be a byte!")
+	}
+	return byte(*info.OldLicensee), nil
+}
+
+func getSGBFlag(info Info) (byte, error) {
+	if !info.SGB {
+		return 0x00, nil
+	}
+	if oldLicensee, _ := getOldLicensee(info); oldLicensee != useNewLicensee {
+		return 0, errors.New("SGB support requires the old licensee code to be 0x33!")
+	}
+	return 0x03, nil
+}
+
+func getDestinationCode(info Info) (byte, error) {
+	if info.Destination == "" {
+		return destinationCodes["OVERSEAS"], nil
+	}
+	code, ok := destinationCodes[strings.ToUpper(info.Destination)]
+	if !ok {
+		return 0, errors.New("Unknown destination '" + info.Destination + "', expected JAPAN or OVERSEAS!")
+	}
+	return code, nil
+}
+
+func getVersion(info Info) (byte, error) {
+	if info.Version < 0 || info.Version > 0xFF {
+		return 0, errors.New("Version must be between 0 and 255!")
+	}
+	return byte(info.Version), nil
+}
+
+// getLogo returns the logo bitmap, which can be changed for testing flash carts. The Gameboy won't start with any other logo.
+func getLogo(info Info) ([]byte, error) {
+	if info.Logo == "" {
+		return LogoBitmap, nil
+	}
+	logo, err := hex.DecodeString(strings.Join(strings.Fields(info.Logo), ""))
+	if err != nil || len(logo) != len(LogoBitmap) {
+		return nil, errors.New("Logo must be 48 bytes, in hexadecimal!")
+	}
+	return logo, nil
+}
+
+func isPrintableASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] < 0x20 || text[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
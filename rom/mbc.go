@@ -0,0 +1,146 @@
+package rom
+
+import (
+	"errors"
+	"strings"
+)
+
+// MBCInfo describes the limits of a memory bank controller.
+type MBCInfo struct {
+	MaxROMSize   int // in KiB
+	MaxRAMSize   int // in KiB
+	CanHaveTimer bool
+	CanRumble    bool
+}
+
+// MBCs contains the supported memory bank controllers, keyed by the name used in info.toml.
+var MBCs = map[string]MBCInfo{
+	"NONE": MBCInfo{32, 8, false, false},
+	"MBC1": MBCInfo{2048, 32, false, false},
+	"MBC2": MBCInfo{256, 0, false, false}, // has 512 half-bytes of built-in RAM instead
+	"MBC3": MBCInfo{2048, 32, true, false},
+	"MBC5": MBCInfo{8192, 128, false, true},
+}
+
+var ramSizeCodes = map[int]byte{
+	0:   0x00,
+	8:   0x02,
+	32:  0x03,
+	128: 0x04,
+	64:  0x05,
+}
+
+func getMBCName(info Info) string {
+	if info.MBC == "" {
+		return "NONE"
+	}
+	return strings.ToUpper(info.MBC)
+}
+
+func getROMSize(info Info) int {
+	if info.ROMSize == 0 {
+		return 32
+	}
+	return info.ROMSize
+}
+
+func getCartridgeType(info Info) (byte, error) {
+	hasRAM := (info.RAMSize > 0)
+
+	switch getMBCName(info) {
+	case "NONE":
+		if hasRAM {
+			if info.Battery {
+				return 0x09, nil // ROM+RAM+BATTERY
+			}
+			return 0x08, nil // ROM+RAM
+		}
+		if info.Battery {
+			return 0, errors.New("Battery requires cartridge RAM when there is no MBC!")
+		}
+		return 0x00, nil // ROM ONLY
+
+	case "MBC1":
+		if hasRAM {
+			if info.Battery {
+				return 0x03, nil // MBC1+RAM+BATTERY
+			}
+			return 0x02, nil // MBC1+RAM
+		}
+		if info.Battery {
+			return 0, errors.New("Battery requires cartridge RAM for MBC1!")
+		}
+		return 0x01, nil // MBC1
+
+	case "MBC2":
+		if info.Battery {
+			return 0x06, nil // MBC2+BATTERY
+		}
+		return 0x05, nil // MBC2
+
+	case "MBC3":
+		if info.Timer {
+			if !info.Battery {
+				return 0, errors.New("Timer requires a battery for MBC3!")
+			}
+			if hasRAM {
+				return 0x10, nil // MBC3+TIMER+RAM+BATTERY
+			}
+			return 0x0F, nil // MBC3+TIMER+BATTERY
+		}
+		if hasRAM {
+			if info.Battery {
+				return 0x13, nil // MBC3+RAM+BATTERY
+			}
+			return 0x12, nil // MBC3+RAM
+		}
+		if info.Battery {
+			return 0, errors.New("Battery requires cartridge RAM or a timer for MBC3!")
+		}
+		return 0x11, nil // MBC3
+
+	case "MBC5":
+		if info.Rumble {
+			if hasRAM {
+				if info.Battery {
+					return 0x1E, nil // MBC5+RUMBLE+RAM+BATTERY
+				}
+				return 0x1D, nil // MBC5+RUMBLE+RAM
+			}
+			if info.Battery {
+				return 0, errors.New("Battery requires cartridge RAM for MBC5!")
+			}
+			return 0x1C, nil // MBC5+RUMBLE
+		}
+		if hasRAM {
+			if info.Battery {
+				return 0x1B, nil // MBC5+RAM+BATTERY
+			}
+			return 0x1A, nil // MBC5+RAM
+		}
+		if info.Battery {
+			return 0, errors.New("Battery requires cartridge RAM for MBC5!")
+		}
+		return 0x19, nil // MBC5
+	}
+
+	return 0, errors.New("Unknown MBC '" + info.MBC + "'!")
+}
+
+func getROMSizeCode(info Info) (byte, error) {
+	romSize := getROMSize(info)
+	for code := 0; code <= 8; code++ {
+		if (32 << uint(code)) == romSize {
+			return byte(code), nil
+		}
+	}
+	return 0, errors.New("ROM size must be a power of two between 32 and 8192 KiB!")
+}
+
+func getRAMSizeCode(info Info) (byte, error) {
+	code, ok := ramSizeCodes[info.RAMSize]
+	if !ok {
+		return 0, errors.New("RAM size must be 0, 8, 32, 64, or 128 KiB!")
+	}
+	return code, nil
+}
@@ -0,0 +1,56 @@
+package rom
+
+import "testing"
+
+func TestCartridgeType(t *testing.T) {
+	tests := []struct {
+		info     Info
+		expected byte
+	}{
+		{Info{}, 0x00},
+		{Info{RAMSize: 8, Battery: true}, 0x09},
+		{Info{MBC: "MBC1"}, 0x01},
+		{Info{MBC: "mbc1", RAMSize: 32, Battery: true}, 0x03},
+		{Info{MBC: "MBC2", Battery: true}, 0x06},
+		{Info{MBC: "MBC3", Timer: true, Battery: true}, 0x0F},
+		{Info{MBC: "MBC3", RAMSize: 32}, 0x12},
+		{Info{MBC: "MBC5"}, 0x19},
+		{Info{MBC: "MBC5", RAMSize: 128, Battery: true, Rumble: true}, 0x1E},
+	}
+	for _, test := range tests {
+		cartridgeType, err := getCartridgeType(test.info)
+		if err != nil {
+			t.Errorf("Cartridge type for %+v failed with '%s'", test.info, err)
+		} else if cartridgeType != test.expected {
+			t.Errorf("Cartridge type for %+v was 0x%02X, should have been 0x%02X", test.info, cartridgeType, test.expected)
+		}
+	}
+
+	if _, err := getCartridgeType(Info{MBC: "MBC1", Battery: true}); err == nil {
+		t.Errorf("Battery without RAM should not be allowed for MBC1")
+	}
+	if _, err := getCartridgeType(Info{MBC: "MBC7"}); err == nil {
+		t.Errorf("Unknown MBC should not be allowed")
+	}
+}
+
+func TestSizeCodes(t *testing.T) {
+	romSizes := map[int]byte{0: 0x00, 32: 0x00, 64: 0x01, 512: 0x04, 8192: 0x08}
+	for size, expected := range romSizes {
+		code, err := getROMSizeCode(Info{ROMSize: size})
+		if err != nil || code != expected {
+			t.Errorf("ROM size code for %d KiB was 0x%02X (%v), should have been 0x%02X", size, code, err, expected)
+		}
+	}
+	if _, err := getROMSizeCode(Info{ROMSize: 48}); err == nil {
+		t.Errorf("ROM size of 48 KiB should not be allowed")
+	}
+
+	ramSizes := map[int]byte{0: 0x00, 8: 0x02, 32: 0x03, 64: 0x05, 128: 0x04}
+	for size, expected := range ramSizes {
+		code, err := getRAMSizeCode(Info{RAMSize: size})
+		if err != nil || code != expected {
+			t.Errorf("RAM size code for %d KiB was 0x%02X (%v), should have been 0x%02X", size, code, err, expected)
+		}
+	}
+}
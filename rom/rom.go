@@ -2,21 +2,80 @@ package rom
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/thatoddmailbox/gbasm/utils"
 )
 
 type Info struct {
-	Name        string
-	SupportsDMG bool
+	Name         string // up to 15 characters, or 11 if there's a manufacturer code
+	Manufacturer string // 4 characters, optional
+	SupportsDMG  bool   // the same as setting CGB to COMPATIBLE
+	CGB          string // ONLY, COMPATIBLE, or NONE, defaults to ONLY
+
+	Licensee    string // the new licensee code, 2 characters, defaults to "01"
+	OldLicensee *int   // defaults to 0x33, which means the new licensee code is used
+	SGB         bool
+	Destination string // JAPAN or OVERSEAS, defaults to OVERSEAS
+	Version     int    // the mask ROM version
+	Logo        string // 48 bytes in hexadecimal, only for testing since the Gameboy won't start with anything but the default
+
+	MBC     string
+	ROMSize int // in KiB, defaults to 32
+	RAMSize int // in KiB
+	Battery bool
+	Timer   bool
+	Rumble  bool
+
+	Entry   string            // the label to jump to when the Gameboy starts, instead of 0x150
+	Vectors map[string]string // the label to jump to for each RST or interrupt vector, by the vector's name
+
+	IncludePaths []string // folders that included files are looked for in, relative to the info.toml
+}
+
+// Label describes where a label points to.
+type Label struct {
+	Bank    int
+	Address int
 }
 
 type ROM struct {
 	Info                 Info
-	Output               [32 * utils.KiB]byte
+	Output               []byte
 	UsedByteCount        int
+	UsedRAMByteCounts    map[string]int // by section type
 	Definitions          map[string]int
 	UnpointedDefinitions []string
+	DeclaredConstants    []string // the constants declared so far in the current pass, for .ifdef and DEF()
+	Labels               map[string]Label
+	SectionSizes         map[string]int
+
+	// Relocatable is true while assembling, before the linker has placed any labels.
+	// References to labels are assembled with placeholder values until then.
+	Relocatable bool
+}
+
+// BankSize is the size of one ROM bank.
+const BankSize = 16 * utils.KiB
+
+// VectorSize is how many bytes there are for each RST or interrupt vector, before the next one starts.
+const VectorSize = 8
+
+// Vectors contains the addresses of the RST instructions and interrupts.
+var Vectors = map[string]int{
+	"rst00":  0x00,
+	"rst08":  0x08,
+	"rst10":  0x10,
+	"rst18":  0x18,
+	"rst20":  0x20,
+	"rst28":  0x28,
+	"rst30":  0x30,
+	"rst38":  0x38,
+	"vblank": 0x40,
+	"stat":   0x48,
+	"timer":  0x50,
+	"serial": 0x58,
+	"joypad": 0x60,
 }
 
 var LogoBitmap = []byte{0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0C, 0x00, 0x0D, 0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99, 0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E}
@@ -39,16 +98,102 @@ func calculateGlobalChecksum(array []byte) int {
 	return result
 }
 
+// GetBank returns the ROM bank that the given offset into the output is in.
+func GetBank(offset int) int {
+	return offset / BankSize
+}
+
+// GetAddress returns the address that the CPU sees the given offset into the output at.
+func GetAddress(offset int) int {
+	if offset < BankSize {
+		return offset
+	}
+	return BankSize + (offset % BankSize)
+}
+
+// GetOffset returns the offset into the output of the given address in the given bank.
+// Bank 0 is treated as bank 1 for addresses in the switchable area.
+func GetOffset(bank int, address int) int {
+	if address < BankSize {
+		return address
+	}
+	if bank == 0 {
+		bank = 1
+	}
+	return bank*BankSize + (address - BankSize)
+}
+
 // ValidateParameters ensures that the provided ROM info is valid.
-func ValidateParameters() {
-	if len(Current.Info.Name) > 15 {
-		panic(errors.New("Specified name for ROM is too long!"))
+func ValidateParameters() error {
+	if _, err := getCGBFlag(Current.Info); err != nil {
+		return err
+	}
+	if _, err := getTitle(Current.Info); err != nil {
+		return err
+	}
+	if _, err := getLicensee(Current.Info); err != nil {
+		return err
+	}
+	if _, err := getOldLicensee(Current.Info); err != nil {
+		return err
+	}
+	if _, err := getSGBFlag(Current.Info); err != nil {
+		return err
+	}
+	if _, err := getDestinationCode(Current.Info); err != nil {
+		return err
+	}
+	if _, err := getVersion(Current.Info); err != nil {
+		return err
+	}
+	if _, err := getLogo(Current.Info); err != nil {
+		return err
 	}
+
+	mbc, ok := MBCs[getMBCName(Current.Info)]
+	if !ok {
+		return errors.New("Unknown MBC '" + Current.Info.MBC + "'!")
+	}
+
+	if _, err := getROMSizeCode(Current.Info); err != nil {
+		return err
+	}
+	if getROMSize(Current.Info) > mbc.MaxROMSize {
+		return errors.New("Specified ROM size is too big for the MBC!")
+	}
+
+	if _, err := getRAMSizeCode(Current.Info); err != nil {
+		return err
+	}
+	if Current.Info.RAMSize > mbc.MaxRAMSize {
+		return errors.New("Specified RAM size is too big for the MBC!")
+	}
+
+	if Current.Info.Timer && !mbc.CanHaveTimer {
+		return errors.New("Specified MBC does not have a timer!")
+	}
+	if Current.Info.Rumble && !mbc.CanRumble {
+		return errors.New("Specified MBC does not support rumble!")
+	}
+
+	if _, err := getCartridgeType(Current.Info); err != nil {
+		return err
+	}
+
+	for name := range Current.Info.Vectors {
+		if _, ok := Vectors[strings.ToLower(name)]; !ok {
+			return errors.New("Unknown vector '" + name + "'!")
+		}
+	}
+
+	return nil
 }
 
 // Initialize sets up the ROM data with the provided information.
 func Initialize() {
 	Current.Definitions = map[string]int{}
+	Current.Labels = map[string]Label{}
+	Current.Output = make([]byte, getROMSize(Current.Info)*utils.KiB)
 
 	// create the header
 
@@ -58,34 +203,75 @@ func Initialize() {
 	Current.Output[0x102] = 0x50 // 0x50
 	Current.Output[0x103] = 0x01 // 0x01
 
-	// logo bitmap
-	copy(Current.Output[0x104:], LogoBitmap)
+	// everything else was checked by ValidateParameters, so the errors can't happen here
+	logo, err := getLogo(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	copy(Current.Output[0x104:], logo)
 
-	// name
-	nameArray := []byte(Current.Info.Name)
-	copy(Current.Output[0x134:], nameArray) // left over bytes will be null
+	// title and manufacturer code, left over bytes will be null
+	title, err := getTitle(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	copy(Current.Output[0x134:], title)
 
-	// CGB bit
-	if Current.Info.SupportsDMG {
-		Current.Output[0x143] = 0x80 // DMG/CGB compatible
-	} else {
-		Current.Output[0x143] = 0xc0 // CGB exclusive
+	// CGB flag, which DMG-only games don't have, so it's part of the title there
+	if GetCGBMode(Current.Info) != CGBNone {
+		cgbFlag, err := getCGBFlag(Current.Info)
+		if err != nil {
+			panic(err)
+		}
+		Current.Output[0x143] = cgbFlag
 	}
 
-	// licensee code
-	Current.Output[0x144] = 0x30 // "0"
-	Current.Output[0x145] = 0x31 // "1"
+	licensee, err := getLicensee(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	copy(Current.Output[0x144:], licensee)
 
-	Current.Output[0x146] = 0x00 // SGB flag
-	Current.Output[0x147] = 0x00 // Cartridge type (set to ROM ONLY for now)
-	Current.Output[0x148] = 0x00 // ROM size (set to 32 KiB for now)
-	Current.Output[0x149] = 0x00 // RAM size (set to no built-in RAM for now)
+	sgbFlag, err := getSGBFlag(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	Current.Output[0x146] = sgbFlag
 
-	Current.Output[0x14A] = 0x01 // Destination code (set to not-Japan)
+	// cartridge type, ROM size, and RAM size
+	cartridgeType, err := getCartridgeType(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	romSizeCode, err := getROMSizeCode(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	ramSizeCode, err := getRAMSizeCode(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	Current.Output[0x147] = cartridgeType
+	Current.Output[0x148] = romSizeCode
+	Current.Output[0x149] = ramSizeCode
+
+	destinationCode, err := getDestinationCode(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	Current.Output[0x14A] = destinationCode
 
-	Current.Output[0x14B] = 0x33 // Old licensee code (unused)
+	oldLicensee, err := getOldLicensee(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	Current.Output[0x14B] = oldLicensee
 
-	Current.Output[0x14C] = 0x00 // Mask ROM version
+	version, err := getVersion(Current.Info)
+	if err != nil {
+		panic(err)
+	}
+	Current.Output[0x14C] = version // mask ROM version
 
 	// header checksum (global checksum is done at end)
 	Current.Output[0x14D] = calculateHeaderChecksum(Current.Output[0x134:0x14D])
@@ -0,0 +1,97 @@
+package rom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBankAddresses(t *testing.T) {
+	tests := []struct {
+		offset  int
+		bank    int
+		address int
+	}{
+		{0x0150, 0, 0x0150},
+		{0x3FFF, 0, 0x3FFF},
+		{0x4000, 1, 0x4000},
+		{0x7FFF, 1, 0x7FFF},
+		{0x8000, 2, 0x4000},
+		{0x1A123, 6, 0x6123},
+	}
+	for _, test := range tests {
+		if bank := GetBank(test.offset); bank != test.bank {
+			t.Errorf("Bank of offset 0x%X was %d, should have been %d", test.offset, bank, test.bank)
+		}
+		if address := GetAddress(test.offset); address != test.address {
+			t.Errorf("Address of offset 0x%X was 0x%X, should have been 0x%X", test.offset, address, test.address)
+		}
+		if offset := GetOffset(test.bank, test.address); offset != test.offset {
+			t.Errorf("Offset of 0x%X in bank %d was 0x%X, should have been 0x%X", test.address, test.bank, offset, test.offset)
+		}
+	}
+
+	if offset := GetOffset(0, 0x4000); offset != 0x4000 {
+		t.Errorf("Offset of 0x4000 in bank 0 was 0x%X, should have been 0x4000", offset)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	oldLicensee := 0x01
+	tests := []struct {
+		info     Info
+		offset   int
+		expected string
+	}{
+		{Info{Name: "GAME"}, 0x134, "GAME\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xC0"},
+		{Info{Name: "GAME", SupportsDMG: true}, 0x143, "\x80"},
+		{Info{Name: "GAME", CGB: "compatible"}, 0x143, "\x80"},
+		{Info{Name: "SIXTEEN CHARS!!!", CGB: "NONE"}, 0x134, "SIXTEEN CHARS!!!"},
+		{Info{Name: "GAME", Manufacturer: "ABCD"}, 0x134, "GAME\x00\x00\x00\x00\x00\x00\x00ABCD\xC0"},
+		{Info{}, 0x144, "01\x00"},
+		{Info{Licensee: "A4", SGB: true}, 0x144, "A4\x03"},
+		{Info{}, 0x14A, "\x01\x33\x00"},
+		{Info{Destination: "Japan", OldLicensee: &oldLicensee, Version: 2}, 0x14A, "\x00\x01\x02"},
+		{Info{Logo: strings.Repeat("12 34 ", 24)}, 0x104, strings.Repeat("\x12\x34", 24)},
+		{Info{}, 0x104, string(LogoBitmap)},
+	}
+	for _, test := range tests {
+		Current = ROM{Info: test.info}
+		if err := ValidateParameters(); err != nil {
+			t.Errorf("Validating %+v failed with '%s'", test.info, err)
+			continue
+		}
+		Initialize()
+		if header := string(Current.Output[test.offset : test.offset+len(test.expected)]); header != test.expected {
+			t.Errorf("Header at 0x%X for %+v was % X, should have been % X", test.offset, test.info, header, test.expected)
+		}
+		if checksum := calculateHeaderChecksum(Current.Output[0x134:0x14D]); Current.Output[0x14D] != checksum {
+			t.Errorf("Header checksum for %+v was 0x%02X, should have been 0x%02X", test.info, Current.Output[0x14D], checksum)
+		}
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	oldLicensee := 0x01
+	bigOldLicensee := 0x100
+	tests := map[string]Info{
+		"long name":                   {Name: "SIXTEEN CHARS!!!"},
+		"long name with manufacturer": {Name: "TWELVE CHARS", Manufacturer: "ABCD"},
+		"short manufacturer":          {Manufacturer: "ABC"},
+		"non-ASCII name":              {Name: "CAFÉ"},
+		"unknown CGB mode":            {CGB: "MAYBE"},
+		"conflicting CGB mode":        {CGB: "NONE", SupportsDMG: true},
+		"long licensee":               {Licensee: "ABC"},
+		"big old licensee":            {OldLicensee: &bigOldLicensee},
+		"SGB with old licensee":       {SGB: true, OldLicensee: &oldLicensee},
+		"unknown destination":         {Destination: "MARS"},
+		"big version":                 {Version: 256},
+		"short logo":                  {Logo: "CEED"},
+		"logo that isn't hex":         {Logo: strings.Repeat("ZZ", 48)},
+	}
+	for name, info := range tests {
+		Current = ROM{Info: info}
+		if err := ValidateParameters(); err == nil {
+			t.Errorf("Validating info with %s should have failed", name)
+		}
+	}
+}